@@ -6,10 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strconv"
 	"strings"
 
+	"github.com/aldy505/phc-crypto/argon2/internal/argon2core"
 	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/internal/sealed"
 	"golang.org/x/crypto/argon2"
 )
 
@@ -21,6 +22,58 @@ type Config struct {
 	KeyLen      int
 	SaltLen     int
 	Variant     Variant
+	// KeyProvider returns the secret key (pepper) that is mixed into the hash as the
+	// Argon2 secret input. Hashes created with it record KeyID in the keyid parameter,
+	// and Verify asks the KeyProvider for the key of that ID.
+	KeyProvider KeyProvider
+	// KeyID is the ID of the secret key used by Hash, from 1 up to 8 bytes long.
+	// It is required when KeyProvider is set.
+	KeyID string
+	// AssociatedData is mixed into the hash and recorded in the data parameter, up to 32 bytes long.
+	AssociatedData []byte
+	// Limits caps the parameters of the hashes accepted by Verify.
+	// Empty fields fall back to DefaultLimits.
+	Limits Limits
+}
+
+// Limits caps the parameters that Verify accepts from a hash, so that a hash with
+// a hostile cost can't exhaust the memory or the CPU of the verifier.
+// The check is done before any hashing work starts, and a hash that exceeds
+// any of the limits is rejected with format.ErrLimitExceeded.
+type Limits struct {
+	// MaxTime is the maximum number of iterations (t)
+	MaxTime int
+	// MaxMemory is the maximum amount of memory in kilobytes (m)
+	MaxMemory int
+	// MaxParallelism is the maximum degree of parallelism (p)
+	MaxParallelism int
+	// MaxKeyLen is the maximum length of the hash in bytes
+	MaxKeyLen int
+	// MaxSaltLen is the maximum length of the salt in bytes
+	MaxSaltLen int
+}
+
+// DefaultLimits are the limits used by Verify, and by Config.Verify for the empty fields of Config.Limits.
+var DefaultLimits = Limits{
+	MaxTime:        64,
+	MaxMemory:      1024 * 1024,
+	MaxParallelism: 64,
+	MaxKeyLen:      1024,
+	MaxSaltLen:     1024,
+}
+
+// KeyProvider returns the secret key of a key ID, so that the keys can be rotated
+// while the hashes created with the previous keys can still be verified.
+type KeyProvider interface {
+	Key(id string) ([]byte, error)
+}
+
+// KeyProviderFunc is a function that implements KeyProvider.
+type KeyProviderFunc func(id string) ([]byte, error)
+
+// Key returns f(id).
+func (f KeyProviderFunc) Key(id string) ([]byte, error) {
+	return f(id)
 }
 
 // Variant sets up enum for available Argon2 variants
@@ -31,6 +84,9 @@ const (
 	ID Variant = iota
 	// I points to Argon2 i variant
 	I
+	// D points to Argon2 d variant. It uses data-dependent memory access, which makes it
+	// vulnerable to side-channel attacks, and should only be used to verify existing hashes.
+	D
 )
 
 const (
@@ -48,7 +104,42 @@ const (
 	SALT_LENGTH = 32
 )
 
+var (
+	// RFC9106LowMemory is the second recommended option of RFC 9106, for environments
+	// that can't afford 2 GiB of memory per hash: argon2id with t=3, m=64 MiB and p=4.
+	RFC9106LowMemory = Config{
+		Time:        3,
+		Memory:      64 * 1024,
+		Parallelism: 4,
+		KeyLen:      32,
+		SaltLen:     16,
+		Variant:     ID,
+	}
+	// OWASPMinimum is the minimum configuration of the OWASP Password Storage Cheat Sheet:
+	// argon2id with t=2, m=19 MiB and p=1.
+	OWASPMinimum = Config{
+		Time:        2,
+		Memory:      19 * 1024,
+		Parallelism: 1,
+		KeyLen:      32,
+		SaltLen:     16,
+		Variant:     ID,
+	}
+)
+
 var ErrEmptyField error = errors.New("function parameters must not be empty")
+var ErrInvalidVariant error = errors.New("invalid argon2 variant")
+var ErrMissingKeyProvider error = errors.New("a key provider is required for hashes with a keyid")
+var ErrInvalidKeyID error = errors.New("key id must be between 1 and 8 bytes")
+var ErrInvalidAssociatedData error = errors.New("associated data must not exceed 32 bytes")
+var ErrUnsupportedVersion error = errors.New("unsupported argon2 version")
+
+const (
+	// maxKeyIDLength is the maximum length of the keyid parameter, as specified by the PHC string format.
+	maxKeyIDLength = 8
+	// maxDataLength is the maximum length of the data parameter, as specified by the PHC string format.
+	maxDataLength = 32
+)
 
 // Hash creates a PHC-formatted hash with config provided
 //
@@ -74,23 +165,36 @@ func Hash(plain string, config Config) (string, error) {
 		return "", ErrEmptyField
 	}
 
-	if config.KeyLen <= 0 {
-		config.KeyLen = KEY_LENGTH
-	}
-	if config.Time <= 0 {
-		config.Time = TIME
+	config = applyDefaults(config)
+
+	if returnVariant(config.Variant) == "" {
+		return "", ErrInvalidVariant
 	}
-	if config.Memory <= 0 {
-		config.Memory = MEMORY
+
+	if len(config.AssociatedData) > maxDataLength {
+		return "", ErrInvalidAssociatedData
 	}
-	if config.Parallelism <= 0 {
-		config.Parallelism = PARALLELISM
+
+	params := []format.Param{
+		{Name: "m", Value: config.Memory},
+		{Name: "t", Value: config.Time},
+		{Name: "p", Value: config.Parallelism},
 	}
-	if config.Variant < 0 || config.Variant > 1 {
-		config.Variant = DEFAULT_VARIANT
+
+	var secret []byte
+	if config.KeyProvider != nil {
+		if config.KeyID == "" || len(config.KeyID) > maxKeyIDLength {
+			return "", ErrInvalidKeyID
+		}
+		key, err := config.KeyProvider.Key(config.KeyID)
+		if err != nil {
+			return "", fmt.Errorf("getting key %q: %w", config.KeyID, err)
+		}
+		secret = key
+		params = append(params, format.Param{Name: "keyid", Value: []byte(config.KeyID)})
 	}
-	if config.SaltLen <= 0 {
-		config.SaltLen = SALT_LENGTH
+	if len(config.AssociatedData) > 0 {
+		params = append(params, format.Param{Name: "data", Value: config.AssociatedData})
 	}
 
 	// random-generated salt (16 bytes recommended for password hashing)
@@ -99,28 +203,21 @@ func Hash(plain string, config Config) (string, error) {
 		return "", fmt.Errorf("reading random reader: %w", err)
 	}
 
-	var hash []byte
-	if config.Variant == ID {
-		hash = argon2.IDKey([]byte(plain), salt, uint32(config.Time), uint32(config.Memory), uint8(config.Parallelism), uint32(config.KeyLen))
-	} else if config.Variant == I {
-		hash = argon2.Key([]byte(plain), salt, uint32(config.Time), uint32(config.Memory), uint8(config.Parallelism), uint32(config.KeyLen))
-	}
+	hash := deriveKey(config.Variant, []byte(plain), salt, secret, config.AssociatedData, uint32(config.Time), uint32(config.Memory), uint8(config.Parallelism), uint32(config.KeyLen))
 	version := argon2.Version
 	hashString := format.Serialize(format.PHCConfig{
-		ID:      "argon2" + returnVariant(config.Variant),
-		Version: version,
-		Params: map[string]interface{}{
-			"m": int(config.Memory),
-			"t": int(config.Time),
-			"p": int(config.Parallelism),
-		},
-		Salt: salt,
-		Hash: hash,
+		ID:            "argon2" + returnVariant(config.Variant),
+		Version:       version,
+		OrderedParams: params,
+		Salt:          salt,
+		Hash:          hash,
 	})
 	return hashString, nil
 }
 
 // Verify checks the hash if it's equal (by an algorithm) to plain text provided.
+// Only the hashes of version 0x13 (v=19) can be verified, the other ones are rejected
+// with ErrUnsupportedVersion.
 //
 //	package main
 //
@@ -139,7 +236,32 @@ func Hash(plain string, config Config) (string, error) {
 //	  fmt.Println(verify) // true
 //	}
 func Verify(hash string, plain string) (bool, error) {
-	if hash == "" || plain == "" {
+	return Config{}.Verify(hash, plain)
+}
+
+// NeedsRehash checks whether the hash was created with a different variant, or with weaker
+// parameters (memory, time, parallelism, salt length or key length) than the config provided.
+// When the config has a KeyProvider, hashes created without the secret key of config.KeyID
+// (with a rotated key or without any) also need rehash.
+//
+//	package main
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/argon2"
+//	)
+//
+//	func main() {
+//	  hash := "$argon2i$v=19$m=65536,t=16,p=3$8400b4e5f01f30092b794de34c61a6fdfea6b6b446560fda08a876bd11e9c62e$3fd77927d189..."
+//
+//	  rehash, err := argon2.NeedsRehash(hash, argon2.Config{Variant: argon2.ID})
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(rehash) // true
+//	}
+func NeedsRehash(hash string, config Config) (bool, error) {
+	if hash == "" {
 		return false, ErrEmptyField
 	}
 
@@ -152,32 +274,179 @@ func Verify(hash string, plain string) (bool, error) {
 		return false, errors.New("hashed string is not argon instance")
 	}
 
-	keyLen := uint32(len(deserialize.Hash))
+	if _, err := parseVariant(deserialize.ID); err != nil {
+		return false, err
+	}
+
+	config = applyDefaults(config)
+
+	if returnVariant(config.Variant) == "" {
+		return false, ErrInvalidVariant
+	}
+
+	if deserialize.ID != "argon2"+returnVariant(config.Variant) || deserialize.Version != argon2.Version {
+		return true, nil
+	}
 
-	time, err := strconv.ParseUint(deserialize.Params["t"].(string), 10, 32)
+	time, memory, parallelism, err := parseParams(deserialize)
 	if err != nil {
 		return false, err
 	}
-	memory, err := strconv.ParseUint(deserialize.Params["m"].(string), 10, 32)
+
+	keyID, _, err := parseKeyParams(deserialize)
 	if err != nil {
 		return false, err
 	}
-	parallelism, err := strconv.ParseUint(deserialize.Params["p"].(string), 10, 32)
+	if config.KeyProvider != nil && keyID != config.KeyID {
+		return true, nil
+	}
+
+	return uint64(time) < uint64(config.Time) ||
+		uint64(memory) < uint64(config.Memory) ||
+		uint64(parallelism) < uint64(config.Parallelism) ||
+		len(deserialize.Salt) < config.SaltLen ||
+		len(deserialize.Hash) < config.KeyLen, nil
+}
+
+// parseParams reads the parameters of a deserialized hash, making sure that
+// there are no unknown parameters and that the values are usable by argon2.
+func parseParams(deserialize format.PHCConfig) (time, memory uint32, parallelism uint8, err error) {
+	if err = deserialize.CheckParams("m", "t", "p", "keyid", "data"); err != nil {
+		return
+	}
+
+	time, err = deserialize.Uint32("t")
 	if err != nil {
-		return false, err
+		return
+	}
+	if time < 1 {
+		err = fmt.Errorf("%w: t must be at least 1", format.ErrInvalidParam)
+		return
 	}
 
-	var verifyHash []byte
-	if deserialize.ID == "argon2id" {
-		verifyHash = argon2.IDKey([]byte(plain), deserialize.Salt, uint32(time), uint32(memory), uint8(parallelism), keyLen)
-	} else if deserialize.ID == "argon2i" {
-		verifyHash = argon2.Key([]byte(plain), deserialize.Salt, uint32(time), uint32(memory), uint8(parallelism), keyLen)
+	memory, err = deserialize.Uint32("m")
+	if err != nil {
+		return
 	}
 
-	if subtle.ConstantTimeCompare(verifyHash, deserialize.Hash) == 1 {
-		return true, nil
+	p, err := deserialize.Uint32("p")
+	if err != nil {
+		return
 	}
-	return false, nil
+	if p < 1 || p > 255 {
+		err = fmt.Errorf("%w: p must be between 1 and 255", format.ErrInvalidParam)
+		return
+	}
+	parallelism = uint8(p)
+	return
+}
+
+// parseKeyParams reads the optional keyid and data parameters of a deserialized hash.
+func parseKeyParams(deserialize format.PHCConfig) (keyID string, data []byte, err error) {
+	if _, ok := deserialize.Params["keyid"]; ok {
+		var id []byte
+		id, err = deserialize.Bytes("keyid")
+		if err != nil {
+			return
+		}
+		if len(id) == 0 || len(id) > maxKeyIDLength {
+			err = fmt.Errorf("%w: keyid must be between 1 and %d bytes", format.ErrInvalidParam, maxKeyIDLength)
+			return
+		}
+		keyID = string(id)
+	}
+
+	if _, ok := deserialize.Params["data"]; ok {
+		data, err = deserialize.Bytes("data")
+		if err != nil {
+			return
+		}
+		if len(data) > maxDataLength {
+			err = fmt.Errorf("%w: data must not exceed %d bytes", format.ErrInvalidParam, maxDataLength)
+			return
+		}
+	}
+	return
+}
+
+// deriveKey computes the argon2 hash of the password. golang.org/x/crypto/argon2 doesn't implement
+// Argon2d, and doesn't take a secret key or associated data, so only those hashes go through
+// the internal implementation.
+func deriveKey(variant Variant, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	if len(secret) == 0 && len(data) == 0 {
+		switch variant {
+		case ID:
+			return argon2.IDKey(password, salt, time, memory, threads, keyLen)
+		case I:
+			return argon2.Key(password, salt, time, memory, threads, keyLen)
+		}
+	}
+
+	mode := argon2core.Argon2id
+	if variant == I {
+		mode = argon2core.Argon2i
+	} else if variant == D {
+		mode = argon2core.Argon2d
+	}
+	return argon2core.Key(mode, password, salt, secret, data, time, memory, threads, keyLen)
+}
+
+// checkLimits makes sure that none of the parameters of a hash exceeds the limits.
+func checkLimits(limits Limits, time, memory uint32, parallelism uint8, saltLen, keyLen int) error {
+	limits = applyDefaultLimits(limits)
+	switch {
+	case uint64(time) > uint64(limits.MaxTime):
+		return fmt.Errorf("%w: t=%d is above %d", format.ErrLimitExceeded, time, limits.MaxTime)
+	case uint64(memory) > uint64(limits.MaxMemory):
+		return fmt.Errorf("%w: m=%d is above %d", format.ErrLimitExceeded, memory, limits.MaxMemory)
+	case int(parallelism) > limits.MaxParallelism:
+		return fmt.Errorf("%w: p=%d is above %d", format.ErrLimitExceeded, parallelism, limits.MaxParallelism)
+	case saltLen > limits.MaxSaltLen:
+		return fmt.Errorf("%w: salt length %d is above %d", format.ErrLimitExceeded, saltLen, limits.MaxSaltLen)
+	case keyLen > limits.MaxKeyLen:
+		return fmt.Errorf("%w: key length %d is above %d", format.ErrLimitExceeded, keyLen, limits.MaxKeyLen)
+	}
+	return nil
+}
+
+// applyDefaultLimits fills the empty fields of limits with DefaultLimits.
+func applyDefaultLimits(limits Limits) Limits {
+	if limits.MaxTime <= 0 {
+		limits.MaxTime = DefaultLimits.MaxTime
+	}
+	if limits.MaxMemory <= 0 {
+		limits.MaxMemory = DefaultLimits.MaxMemory
+	}
+	if limits.MaxParallelism <= 0 {
+		limits.MaxParallelism = DefaultLimits.MaxParallelism
+	}
+	if limits.MaxKeyLen <= 0 {
+		limits.MaxKeyLen = DefaultLimits.MaxKeyLen
+	}
+	if limits.MaxSaltLen <= 0 {
+		limits.MaxSaltLen = DefaultLimits.MaxSaltLen
+	}
+	return limits
+}
+
+// applyDefaults fills the empty or invalid fields of config with the package defaults.
+func applyDefaults(config Config) Config {
+	if config.KeyLen <= 0 {
+		config.KeyLen = KEY_LENGTH
+	}
+	if config.Time <= 0 {
+		config.Time = TIME
+	}
+	if config.Memory <= 0 {
+		config.Memory = MEMORY
+	}
+	if config.Parallelism <= 0 {
+		config.Parallelism = PARALLELISM
+	}
+	if config.SaltLen <= 0 {
+		config.SaltLen = SALT_LENGTH
+	}
+	return config
 }
 
 // returnVariant converts enum variant to string for serializing hash
@@ -186,6 +455,106 @@ func returnVariant(variant Variant) string {
 		return "id"
 	} else if variant == I {
 		return "i"
+	} else if variant == D {
+		return "d"
 	}
 	return ""
 }
+
+// parseVariant converts the identifier of a hash to its variant.
+func parseVariant(id string) (Variant, error) {
+	switch id {
+	case "argon2id":
+		return ID, nil
+	case "argon2i":
+		return I, nil
+	case "argon2d":
+		return D, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrInvalidVariant, id)
+}
+
+// Hash creates a PHC-formatted hash with the config. See the package-level Hash function.
+func (c Config) Hash(plain string) (string, error) {
+	return Hash(plain, c)
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided,
+// rejecting hashes whose parameters exceed c.Limits. See the package-level Verify function.
+func (c Config) Verify(hash, plain string) (bool, error) {
+	if hash == "" || plain == "" {
+		return false, ErrEmptyField
+	}
+
+	deserialize, err := format.Deserialize(hash)
+	if err != nil {
+		return false, err
+	}
+
+	if !strings.HasPrefix(deserialize.ID, "argon2") {
+		return false, errors.New("hashed string is not argon instance")
+	}
+
+	variant, err := parseVariant(deserialize.ID)
+	if err != nil {
+		return false, err
+	}
+
+	// only version 0x13 is implemented, a hash without a version is of version 0x10
+	if deserialize.OmitVersion {
+		return false, fmt.Errorf("%w: no version, which stands for v=16", ErrUnsupportedVersion)
+	}
+	if deserialize.Version != argon2.Version {
+		return false, fmt.Errorf("%w: v=%d", ErrUnsupportedVersion, deserialize.Version)
+	}
+
+	if len(deserialize.Hash) == 0 {
+		return false, format.ErrMissingHash
+	}
+	keyLen := uint32(len(deserialize.Hash))
+
+	time, memory, parallelism, err := parseParams(deserialize)
+	if err != nil {
+		return false, err
+	}
+
+	if err := checkLimits(c.Limits, time, memory, parallelism, len(deserialize.Salt), len(deserialize.Hash)); err != nil {
+		return false, err
+	}
+
+	keyID, data, err := parseKeyParams(deserialize)
+	if err != nil {
+		return false, err
+	}
+
+	var secret []byte
+	if keyID != "" {
+		if c.KeyProvider == nil {
+			return false, ErrMissingKeyProvider
+		}
+		secret, err = c.KeyProvider.Key(keyID)
+		if err != nil {
+			return false, fmt.Errorf("getting key %q: %w", keyID, err)
+		}
+	}
+
+	verifyHash := deriveKey(variant, []byte(plain), deserialize.Salt, secret, data, time, memory, parallelism, keyLen)
+	if subtle.ConstantTimeCompare(verifyHash, deserialize.Hash) == 1 {
+		return true, nil
+	}
+	return false, nil
+}
+
+// NeedsRehash checks whether the hash is weaker than the config. See the package-level NeedsRehash function.
+func (c Config) NeedsRehash(hash string) (bool, error) {
+	return NeedsRehash(hash, c)
+}
+
+// UseConfig makes Config a config of phccrypto.Use, which names every parameter the way
+// the algorithm does. It can only be called by the packages of this module.
+func (c Config) UseConfig(sealed.Token) {}
+
+// IDs returns the PHC identifiers of the hashes that this package can verify.
+func (c Config) IDs() []string {
+	return []string{"argon2id", "argon2i", "argon2d"}
+}
@@ -1,10 +1,15 @@
 package argon2_test
 
 import (
+	"bytes"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aldy505/phc-crypto/argon2"
+	"github.com/aldy505/phc-crypto/format"
 )
 
 func TestHash(t *testing.T) {
@@ -143,3 +148,514 @@ func TestError(t *testing.T) {
 		}
 	})
 }
+
+func TestNeedsRehash(t *testing.T) {
+	config := argon2.Config{
+		Time:        2,
+		Memory:      1024,
+		Parallelism: 2,
+		KeyLen:      32,
+		SaltLen:     16,
+	}
+
+	hash, err := argon2.Hash("password123", config)
+	if err != nil {
+		t.Error(err)
+	}
+
+	t.Run("should return false on the same config", func(t *testing.T) {
+		rehash, err := argon2.NeedsRehash(hash, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+	})
+
+	t.Run("should return false on weaker config", func(t *testing.T) {
+		rehash, err := argon2.NeedsRehash(hash, argon2.Config{Time: 1, Memory: 512, Parallelism: 1, KeyLen: 16, SaltLen: 8})
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+	})
+
+	t.Run("should return true on stronger config", func(t *testing.T) {
+		stronger := []argon2.Config{
+			{Time: 3, Memory: 1024, Parallelism: 2, KeyLen: 32, SaltLen: 16},
+			{Time: 2, Memory: 2048, Parallelism: 2, KeyLen: 32, SaltLen: 16},
+			{Time: 2, Memory: 1024, Parallelism: 4, KeyLen: 32, SaltLen: 16},
+			{Time: 2, Memory: 1024, Parallelism: 2, KeyLen: 64, SaltLen: 16},
+			{Time: 2, Memory: 1024, Parallelism: 2, KeyLen: 32, SaltLen: 32},
+		}
+		for _, c := range stronger {
+			rehash, err := argon2.NeedsRehash(hash, c)
+			if err != nil {
+				t.Error(err)
+			}
+			if !rehash {
+				t.Error("needs rehash function returned false for", c)
+			}
+		}
+	})
+
+	t.Run("should return true on different variant", func(t *testing.T) {
+		config := config
+		config.Variant = argon2.I
+		rehash, err := argon2.NeedsRehash(hash, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should return error", func(t *testing.T) {
+		_, err := argon2.NeedsRehash("$argon3$v=2$t=16,m=64,p=32$invalidSalt$invalidHash", config)
+		if err == nil || err.Error() != "hashed string is not argon instance" {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	testCases := []struct {
+		name string
+		hash string
+		err  error
+	}{
+		{"missing param", "$argon2id$v=19$m=64,t=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrMissingParam},
+		{"duplicate param", "$argon2id$v=19$m=64,t=1,p=1,t=2$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrDuplicateParam},
+		{"unknown param", "$argon2id$v=19$m=64,t=1,p=1,x=2$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrUnknownParam},
+		{"missing hash", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ", format.ErrMissingHash},
+		{"missing salt and hash", "$argon2id$v=19$m=64,t=1,p=1", format.ErrMissingHash},
+		{"zero time", "$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrInvalidParam},
+		{"zero parallelism", "$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrInvalidParam},
+		{"too much parallelism", "$argon2id$v=19$m=64,t=1,p=256$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrInvalidParam},
+		{"key id too long", "$argon2id$v=19$m=64,t=1,p=1,keyid=bG9uZ2VyIHRoYW4gOA$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrInvalidParam},
+		{"key id not base64", "$argon2id$v=19$m=64,t=1,p=1,keyid=a$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrInvalidParam},
+		{"truncated", "$argon2id$", format.ErrInvalidFormat},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := argon2.Verify(tc.hash, "password123")
+			if !errors.Is(err, tc.err) {
+				t.Error("error should have been thrown:", err)
+			}
+		})
+	}
+}
+
+func TestVerifyVersion(t *testing.T) {
+	// the argon2i vector of version 0x10 of the reference implementation, for "password" and "somesalt"
+	testCases := []struct {
+		name string
+		hash string
+	}{
+		{"version 16", "$argon2i$v=16$m=65536,t=2,p=1$c29tZXNhbHQ$9sTbSlTio3Biev89thdrlKKiCaYsjjYVJxGAL3swxpQ"},
+		{"no version", "$argon2i$m=65536,t=2,p=1$c29tZXNhbHQ$9sTbSlTio3Biev89thdrlKKiCaYsjjYVJxGAL3swxpQ"},
+		{"unknown version", "$argon2i$v=20$m=65536,t=2,p=1$c29tZXNhbHQ$9sTbSlTio3Biev89thdrlKKiCaYsjjYVJxGAL3swxpQ"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			verify, err := argon2.Verify(tc.hash, "password")
+			if !errors.Is(err, argon2.ErrUnsupportedVersion) {
+				t.Error("expected ErrUnsupportedVersion, got:", err)
+			}
+			if verify {
+				t.Error("verify function returned true")
+			}
+
+			rehash, err := argon2.NeedsRehash(tc.hash, argon2.Config{Variant: argon2.I})
+			if err != nil {
+				t.Error(err)
+			}
+			if !rehash {
+				t.Error("needs rehash function returned false")
+			}
+		})
+	}
+}
+
+func FuzzVerify(f *testing.F) {
+	hash, err := argon2.Hash("password123", argon2.Config{Time: 1, Memory: 64, Parallelism: 1, KeyLen: 16, SaltLen: 8})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(hash, "password123")
+	f.Add("$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "password123")
+	f.Add("$argon2id$v=19$m=64,t=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "password123")
+	f.Add("$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ", "password123")
+	f.Add("$argon2id$v=19$m=64,t=0,p=0$$AA", "password123")
+	f.Add("$argon2id$", "password123")
+	f.Add("$x$v=1$m$a$b", "password123")
+
+	f.Fuzz(func(t *testing.T, hash string, plain string) {
+		_, _ = argon2.Verify(hash, plain)
+		_, _ = argon2.NeedsRehash(hash, argon2.Config{})
+	})
+}
+
+func TestVerifyLimits(t *testing.T) {
+	t.Run("should reject hashes above the default limits", func(t *testing.T) {
+		testCases := []struct {
+			name string
+			hash string
+		}{
+			{"memory", "$argon2id$v=19$m=4294967295,t=1,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ"},
+			{"time", "$argon2id$v=19$m=64,t=4294967295,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ"},
+			{"parallelism", "$argon2id$v=19$m=64,t=1,p=255$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := argon2.Verify(tc.hash, "password123")
+				if !errors.Is(err, format.ErrLimitExceeded) {
+					t.Error("error should have been thrown:", err)
+				}
+			})
+		}
+	})
+
+	t.Run("should enforce the limits of the config", func(t *testing.T) {
+		hash, err := argon2.Hash("password123", argon2.Config{Time: 2, Memory: 64, Parallelism: 2, KeyLen: 16, SaltLen: 8})
+		if err != nil {
+			t.Error(err)
+		}
+
+		testCases := []struct {
+			name   string
+			limits argon2.Limits
+		}{
+			{"memory", argon2.Limits{MaxMemory: 32}},
+			{"time", argon2.Limits{MaxTime: 1}},
+			{"parallelism", argon2.Limits{MaxParallelism: 1}},
+			{"key length", argon2.Limits{MaxKeyLen: 8}},
+			{"salt length", argon2.Limits{MaxSaltLen: 4}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := argon2.Config{Limits: tc.limits}.Verify(hash, "password123")
+				if !errors.Is(err, format.ErrLimitExceeded) {
+					t.Error("error should have been thrown:", err)
+				}
+			})
+		}
+
+		verify, err := argon2.Config{Limits: argon2.Limits{MaxTime: 2, MaxMemory: 64, MaxParallelism: 2}}.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+}
+
+func TestSecretKey(t *testing.T) {
+	keys := map[string][]byte{
+		"k1": []byte("first pepper"),
+		"k2": []byte("second pepper"),
+	}
+	provider := argon2.KeyProviderFunc(func(id string) ([]byte, error) {
+		key, ok := keys[id]
+		if !ok {
+			return nil, errors.New("unknown key")
+		}
+		return key, nil
+	})
+	config := argon2.Config{Time: 1, Memory: 64, Parallelism: 1, KeyLen: 16, SaltLen: 8, KeyProvider: provider, KeyID: "k1"}
+
+	hash, err := argon2.Hash("password123", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(hash, ",keyid=azE$") {
+		t.Error("hash should record the key id:", hash)
+	}
+
+	t.Run("should verify with the key provider", func(t *testing.T) {
+		verify, err := config.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+
+		verify, err = argon2.Config{KeyProvider: provider}.Verify(hash, "password321")
+		if err != nil {
+			t.Error(err)
+		}
+		if verify {
+			t.Error("verify function returned true")
+		}
+	})
+
+	t.Run("should not verify without the secret key", func(t *testing.T) {
+		_, err := argon2.Verify(hash, "password123")
+		if !errors.Is(err, argon2.ErrMissingKeyProvider) {
+			t.Error("error should have been thrown:", err)
+		}
+
+		wrong := argon2.KeyProviderFunc(func(id string) ([]byte, error) {
+			return []byte("leaked database"), nil
+		})
+		verify, err := argon2.Config{KeyProvider: wrong}.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if verify {
+			t.Error("verify function returned true")
+		}
+
+		failing := argon2.KeyProviderFunc(func(id string) ([]byte, error) {
+			return nil, errors.New("unknown key")
+		})
+		_, err = argon2.Config{KeyProvider: failing}.Verify(hash, "password123")
+		if err == nil {
+			t.Error("error should have been thrown")
+		}
+	})
+
+	t.Run("should need rehash on key rotation", func(t *testing.T) {
+		rehash, err := argon2.NeedsRehash(hash, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("hash with the current key should not need rehash")
+		}
+
+		rotated := config
+		rotated.KeyID = "k2"
+		rehash, err = argon2.NeedsRehash(hash, rotated)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("hash with the previous key should need rehash")
+		}
+
+		plain, err := argon2.Hash("password123", argon2.Config{Time: 1, Memory: 64, Parallelism: 1, KeyLen: 16, SaltLen: 8})
+		if err != nil {
+			t.Error(err)
+		}
+		rehash, err = argon2.NeedsRehash(plain, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("hash without a key should need rehash")
+		}
+	})
+
+	t.Run("should reject invalid key ids", func(t *testing.T) {
+		for _, id := range []string{"", "longer than 8"} {
+			invalid := config
+			invalid.KeyID = id
+			_, err := argon2.Hash("password123", invalid)
+			if !errors.Is(err, argon2.ErrInvalidKeyID) {
+				t.Error("error should have been thrown:", err)
+			}
+		}
+	})
+}
+
+func TestAssociatedData(t *testing.T) {
+	config := argon2.Config{Time: 1, Memory: 64, Parallelism: 1, KeyLen: 16, SaltLen: 8, AssociatedData: []byte("user:42")}
+
+	hash, err := argon2.Hash("password123", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(hash, ",data=dXNlcjo0Mg$") {
+		t.Error("hash should record the associated data:", hash)
+	}
+
+	verify, err := argon2.Verify(hash, "password123")
+	if err != nil {
+		t.Error(err)
+	}
+	if !verify {
+		t.Error("verify function returned false")
+	}
+
+	// the associated data is part of the hash, so it can't be replaced
+	tampered := strings.Replace(hash, "data=dXNlcjo0Mg", "data=dXNlcjo0Mw", 1)
+	verify, err = argon2.Verify(tampered, "password123")
+	if err != nil {
+		t.Error(err)
+	}
+	if verify {
+		t.Error("verify function returned true")
+	}
+
+	_, err = argon2.Hash("password123", argon2.Config{AssociatedData: make([]byte, 33)})
+	if !errors.Is(err, argon2.ErrInvalidAssociatedData) {
+		t.Error("error should have been thrown:", err)
+	}
+}
+
+func TestArgon2d(t *testing.T) {
+	t.Run("should hash and verify argon2d", func(t *testing.T) {
+		hash, err := argon2.Hash("password123", argon2.Config{Time: 1, Memory: 64, Parallelism: 1, Variant: argon2.D})
+		if err != nil {
+			t.Error(err)
+		}
+		if !strings.HasPrefix(hash, "$argon2d$v=19$") {
+			t.Error("hash should be argon2d:", hash)
+		}
+
+		verify, err := argon2.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+
+		verify, err = argon2.Verify(hash, "password321")
+		if err != nil {
+			t.Error(err)
+		}
+		if verify {
+			t.Error("verify function returned true")
+		}
+	})
+
+	t.Run("should verify the RFC 9106 test vector", func(t *testing.T) {
+		provider := argon2.KeyProviderFunc(func(id string) ([]byte, error) {
+			return bytes.Repeat([]byte{0x03}, 8), nil
+		})
+		hash := "$argon2d$v=19$m=32,t=3,p=4,keyid=cmZj,data=BAQEBAQEBAQEBAQE$AgICAgICAgICAgICAgICAg$USs5G28RYpdTcdMJGXNClPho4745hPPBoTpNufq+Sss"
+
+		verify, err := argon2.Config{KeyProvider: provider}.Verify(hash, strings.Repeat("\x01", 32))
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should return error on unknown variant", func(t *testing.T) {
+		for _, variant := range []argon2.Variant{-1, 3} {
+			_, err := argon2.Hash("password123", argon2.Config{Variant: variant})
+			if !errors.Is(err, argon2.ErrInvalidVariant) {
+				t.Error("error should have been thrown:", err)
+			}
+
+			_, err = argon2.NeedsRehash("$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", argon2.Config{Variant: variant})
+			if !errors.Is(err, argon2.ErrInvalidVariant) {
+				t.Error("error should have been thrown:", err)
+			}
+		}
+
+		_, err := argon2.Verify("$argon2x$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "password123")
+		if !errors.Is(err, argon2.ErrInvalidVariant) {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func TestCalibrate(t *testing.T) {
+	t.Run("should stay within the budget and the limits", func(t *testing.T) {
+		config, err := argon2.Calibrate(argon2.ID, 20*time.Millisecond, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Memory > 1024 || config.Time < 1 || config.Time > argon2.DefaultLimits.MaxTime {
+			t.Errorf("unexpected config: %+v", config)
+		}
+
+		hash, err := argon2.Hash("password123", config)
+		if err != nil {
+			t.Error(err)
+		}
+		verify, err := argon2.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should lower the memory for a short target", func(t *testing.T) {
+		config, err := argon2.Calibrate(argon2.ID, time.Nanosecond, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Memory != 8*config.Parallelism || config.Time != 1 {
+			t.Errorf("unexpected config: %+v", config)
+		}
+	})
+
+	t.Run("should return error on invalid arguments", func(t *testing.T) {
+		if _, err := argon2.Calibrate(argon2.ID, 0, 1<<20); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("expected ErrInvalidParam, got:", err)
+		}
+		if _, err := argon2.Calibrate(argon2.ID, time.Second, 1024); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("expected ErrInvalidParam, got:", err)
+		}
+		if _, err := argon2.Calibrate(5, time.Second, 1<<20); !errors.Is(err, argon2.ErrInvalidVariant) {
+			t.Error("expected ErrInvalidVariant, got:", err)
+		}
+	})
+}
+
+func TestPresets(t *testing.T) {
+	presets := []struct {
+		name   string
+		config argon2.Config
+	}{
+		{"RFC9106LowMemory", argon2.RFC9106LowMemory},
+		{"OWASPMinimum", argon2.OWASPMinimum},
+	}
+
+	for _, preset := range presets {
+		t.Run(preset.name+" should be accepted by Verify", func(t *testing.T) {
+			hash, err := argon2.Hash("password123", preset.config)
+			if err != nil {
+				t.Error(err)
+			}
+			verify, err := argon2.Verify(hash, "password123")
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false")
+			}
+
+			rehash, err := argon2.NeedsRehash(hash, preset.config)
+			if err != nil {
+				t.Error(err)
+			}
+			if rehash {
+				t.Error("needs rehash function returned true")
+			}
+		})
+	}
+
+	t.Run("should rehash the hashes of a weaker preset", func(t *testing.T) {
+		hash, err := argon2.Hash("password123", argon2.OWASPMinimum)
+		if err != nil {
+			t.Error(err)
+		}
+		rehash, err := argon2.NeedsRehash(hash, argon2.RFC9106LowMemory)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+}
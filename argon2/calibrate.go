@@ -0,0 +1,73 @@
+package argon2
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/internal/calibrate"
+)
+
+// Calibrate benchmarks Argon2 on the host and returns a Config of the variant whose hashes
+// take about target to be created, with up to memoryBudget bytes of memory per hash.
+// The memory is set to the budget first, and halved while a single pass takes longer than
+// target. The time is then raised to fill the target. The parameters never exceed
+// DefaultLimits, so the hashes are accepted by Verify.
+//
+// Calibrate hashes several times, so it takes a few times the target to return.
+//
+//	import (
+//	  "fmt"
+//	  "time"
+//	  "github.com/aldy505/phc-crypto/argon2"
+//	)
+//
+//	func main() {
+//	  config, err := argon2.Calibrate(argon2.ID, 500*time.Millisecond, 64<<20)
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(config.Time, config.Memory) // 3 65536, depending on the host
+//	}
+func Calibrate(variant Variant, target time.Duration, memoryBudget int) (Config, error) {
+	if err := calibrate.CheckTarget(target); err != nil {
+		return Config{}, err
+	}
+	if returnVariant(variant) == "" {
+		return Config{}, ErrInvalidVariant
+	}
+
+	config := Config{
+		Time:        1,
+		Memory:      min(memoryBudget/1024, DefaultLimits.MaxMemory),
+		Parallelism: PARALLELISM,
+		Variant:     variant,
+	}
+	// Argon2 needs 8 blocks of 1 KiB per lane
+	minMemory := 8 * config.Parallelism
+	if config.Memory < minMemory {
+		return Config{}, fmt.Errorf("%w: memory budget must be at least %d bytes", format.ErrInvalidParam, minMemory*1024)
+	}
+
+	elapsed, err := measure(config)
+	if err != nil {
+		return Config{}, err
+	}
+	for elapsed > target && config.Memory/2 >= minMemory {
+		config.Memory /= 2
+		if elapsed, err = measure(config); err != nil {
+			return Config{}, err
+		}
+	}
+
+	config.Time = calibrate.Scale(config.Time, elapsed, target, 1, DefaultLimits.MaxTime)
+	return config, nil
+}
+
+// measure returns the duration of a hash with config.
+func measure(config Config) (time.Duration, error) {
+	return calibrate.Measure(func() error {
+		_, err := Hash("password", config)
+		return err
+	})
+}
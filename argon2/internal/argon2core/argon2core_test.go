@@ -0,0 +1,36 @@
+package argon2core_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/aldy505/phc-crypto/argon2/internal/argon2core"
+)
+
+// TestRFC9106 checks the test vectors of RFC 9106, section 5.
+func TestRFC9106(t *testing.T) {
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+	secret := bytes.Repeat([]byte{0x03}, 8)
+	data := bytes.Repeat([]byte{0x04}, 12)
+
+	testCases := []struct {
+		name string
+		mode argon2core.Mode
+		tag  string
+	}{
+		{"argon2d", argon2core.Argon2d, "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"},
+		{"argon2i", argon2core.Argon2i, "c814d9d1dc7f37aa13f0d77f2494bda1c8de6b016dd388d29952a4c4672b6ce8"},
+		{"argon2id", argon2core.Argon2id, "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tag := argon2core.Key(tc.mode, password, salt, secret, data, 3, 32, 4, 32)
+			if hex.EncodeToString(tag) != tc.tag {
+				t.Error("tag does not match:", hex.EncodeToString(tag))
+			}
+		})
+	}
+}
@@ -1,26 +1,96 @@
 package bcrypt
 
 import (
+	"encoding/base64"
 	"errors"
-	"strings"
+	"fmt"
+	"strconv"
 
 	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/internal/sealed"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // Config initialize the config require to create a hash function
 type Config struct {
-	Rounds int
+	Rounds  int
+	Variant Variant
+	// SHA256 creates bcrypt-sha256 hashes, the same as passlib. The password is pre-hashed
+	// with HMAC-SHA256, which lifts the 72 bytes limit of bcrypt on passwords.
+	// Verify accepts both kinds of hashes.
+	SHA256 bool
+	// Limits caps the parameters of the hashes accepted by Verify.
+	// Empty fields fall back to DefaultLimits.
+	Limits Limits
 }
 
+// Limits caps the parameters that Verify accepts from a hash, so that a hash with
+// a hostile cost can't pin the CPU of the verifier.
+// The check is done before any hashing work starts, and a hash that exceeds
+// any of the limits is rejected with format.ErrLimitExceeded. Hash is not limited,
+// so a hash above DefaultLimits needs Limits to be raised before it can be verified.
+type Limits struct {
+	// MaxRounds is the maximum cost of rounds, the work grows by 2^MaxRounds
+	MaxRounds int
+}
+
+// DefaultLimits are the limits used by Verify, and by Config.Verify for the empty fields of Config.Limits.
+var DefaultLimits = Limits{
+	MaxRounds: 16,
+}
+
+// Variant sets up enum for available bcrypt variants, which is the minor version
+// of the Modular Crypt Format ($2a$, $2b$ or $2y$). The hashes of the three variants
+// are computed the same way, the variant is only recorded for other implementations.
+type Variant byte
+
+const (
+	// A points to the $2a$ variant
+	A Variant = 'a'
+	// B points to the $2b$ variant, the current one of OpenBSD
+	B Variant = 'b'
+	// Y points to the $2y$ variant of PHP and crypt_blowfish
+	Y Variant = 'y'
+)
+
 const (
 	// ROUNDS is the cost of rounds, minimum of 4, maximum of 31.
 	ROUNDS = 10
+	// DEFAULT_VARIANT is the variant used when none is provided.
+	DEFAULT_VARIANT = B
 )
 
+// OWASP is the minimum work factor of the OWASP Password Storage Cheat Sheet, a cost of 10
+// with the $2b$ variant.
+var OWASP = Config{
+	Rounds:  10,
+	Variant: B,
+}
+
 var ErrEmptyField error = errors.New("function parameters must not be empty")
+var ErrInvalidVariant error = errors.New("invalid bcrypt variant")
 
-// Hash creates a PHC-formatted hash with config provided
+const (
+	// legacyVersion is the version of the hashes created by the previous versions of this package,
+	// which hold the whole Modular Crypt Format string in the hash field.
+	legacyVersion = 0
+	// saltLength is the length of the bcrypt salt in bytes.
+	saltLength = 16
+	// checksumLength is the length of the bcrypt checksum in bytes.
+	checksumLength = 23
+)
+
+// mcfEncoding is the base64 alphabet of the bcrypt Modular Crypt Format.
+var mcfEncoding = base64.NewEncoding("./ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789").WithPadding(base64.NoPadding)
+
+// Hash creates a PHC-formatted hash with config provided.
+// The salt and the checksum of bcrypt have their own fields, and the version is the
+// character code of the variant (v=98 for $2b$), the same as the PHC string format reference.
+//
+// A cost outside of 4 to 31 is refused with bcrypt.InvalidCostError of golang.org/x/crypto/bcrypt.
+//
+// When config.SHA256 is set, it creates a bcrypt-sha256 hash of passlib instead
+// ($bcrypt-sha256$v=2,t=2b,r=12$<salt>$<checksum>), which only exists for the $2b$ variant.
 //
 //	import (
 //	  "fmt"
@@ -34,33 +104,46 @@ var ErrEmptyField error = errors.New("function parameters must not be empty")
 //	  if err != nil {
 //	    fmt.Println(err)
 //	  }
-//	  fmt.Println(hash) // $bcrypt$v=0$r=12$$2432612431322479356256373563666e503557...
+//	  fmt.Println(hash) // $bcrypt$v=98$r=12$Cyzl9S8aUp4MnyfEeAX8SA$wsOAuKL1i3UpyxDwWPT11RRggoQ6evA
 //	}
 func Hash(plain string, config Config) (string, error) {
 	if plain == "" {
 		return "", ErrEmptyField
 	}
 
-	if config.Rounds <= 0 {
-		config.Rounds = ROUNDS
+	config = applyDefaults(config)
+
+	if !validVariant(config.Variant) {
+		return "", ErrInvalidVariant
 	}
+	if config.Rounds < bcrypt.MinCost || config.Rounds > bcrypt.MaxCost {
+		return "", bcrypt.InvalidCostError(config.Rounds)
+	}
+
+	if config.SHA256 {
+		if config.Variant != B {
+			return "", fmt.Errorf("%w: bcrypt-sha256 only supports the $2b$ variant", ErrInvalidVariant)
+		}
+		return hashSHA256(plain, config.Rounds)
+	}
+
 	hash, err := bcrypt.GenerateFromPassword([]byte(plain), config.Rounds)
 	if err != nil {
 		return "", err
 	}
+	// golang.org/x/crypto/bcrypt always creates $2a$ hashes
+	hash[2] = byte(config.Variant)
 
-	hashString := format.Serialize(format.PHCConfig{
-		ID:      "bcrypt",
-		Version: 0,
-		Params: map[string]interface{}{
-			"r": config.Rounds,
-		},
-		Hash: hash,
-	})
-	return hashString, nil
+	deserialize, err := fromMCF(hash)
+	if err != nil {
+		return "", err
+	}
+	return format.Serialize(deserialize), nil
 }
 
 // Verify checks the hash if it's equal (by an algorithm) to plain text provided.
+// Besides PHC-formatted hashes, it accepts bcrypt hashes in Modular Crypt Format ($2a$, $2b$ or $2y$),
+// as created by PHP, Node.js and most other implementations, and the bcrypt-sha256 hashes of passlib.
 //
 //	import (
 //	  "fmt"
@@ -68,7 +151,7 @@ func Hash(plain string, config Config) (string, error) {
 //	)
 //
 //	func main() {
-//	  hash := "$bcrypt$v=0$r=12$$2432612431322479356256373563666e503557..."
+//	  hash := "$bcrypt$v=98$r=12$Cyzl9S8aUp4MnyfEeAX8SA$wsOAuKL1i3UpyxDwWPT11RRggoQ6evA"
 //
 //	  verify, err := bcrypt.Verify(hash, "password")
 //	  if err != nil {
@@ -77,22 +160,313 @@ func Hash(plain string, config Config) (string, error) {
 //	  fmt.Println(verify) // true
 //	}
 func Verify(hash string, plain string) (bool, error) {
-	if hash == "" || plain == "" {
+	return Config{}.Verify(hash, plain)
+}
+
+// NeedsRehash checks whether the hash was created with less rounds or with a different
+// variant than the config provided. Hashes in the legacy encoding (v=0) always need rehash,
+// while hashes in Modular Crypt Format are treated the same as their PHC representation.
+// Bcrypt hashes need rehash to bcrypt-sha256 when config.SHA256 is set, and the other way around,
+// as well as bcrypt-sha256 hashes of the first version.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/bcrypt"
+//	)
+//
+//	func main() {
+//	  hash := "$bcrypt$v=98$r=12$Cyzl9S8aUp4MnyfEeAX8SA$wsOAuKL1i3UpyxDwWPT11RRggoQ6evA"
+//
+//	  rehash, err := bcrypt.NeedsRehash(hash, bcrypt.Config{Rounds: 14})
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(rehash) // true
+//	}
+func NeedsRehash(hash string, config Config) (bool, error) {
+	if hash == "" {
 		return false, ErrEmptyField
 	}
 
-	deserialize, err := format.Deserialize(hash)
+	config = applyDefaults(config)
+
+	if !validVariant(config.Variant) {
+		return false, ErrInvalidVariant
+	}
+
+	var mcf []byte
+	if isSHA256(hash) {
+		parsed, err := parseSHA256(hash)
+		if err != nil {
+			return false, err
+		}
+		if !config.SHA256 || parsed.version != sha256Version {
+			return true, nil
+		}
+		mcf = parsed.mcf
+	} else {
+		deserialize, err := parseHash(hash)
+		if err != nil {
+			return false, err
+		}
+
+		mcf, err = toMCF(deserialize)
+		if err != nil {
+			return false, err
+		}
+		if config.SHA256 || deserialize.Version == legacyVersion || mcf[2] != byte(config.Variant) {
+			return true, nil
+		}
+	}
+
+	rounds, err := bcrypt.Cost(mcf)
 	if err != nil {
 		return false, err
 	}
 
-	if !strings.HasPrefix(deserialize.ID, "bcrypt") {
-		return false, errors.New("hashed string is not a bcrypt instance")
+	return rounds < config.Rounds, nil
+}
+
+// checkLimits makes sure that the cost of a hash doesn't exceed the limits.
+func checkLimits(limits Limits, rounds int) error {
+	maxRounds := limits.MaxRounds
+	if maxRounds <= 0 {
+		maxRounds = DefaultLimits.MaxRounds
+	}
+	if rounds > maxRounds {
+		return fmt.Errorf("%w: cost %d is above %d", format.ErrLimitExceeded, rounds, maxRounds)
+	}
+	return nil
+}
+
+// FromMCF converts a bcrypt hash in Modular Crypt Format ($2a$, $2b$ or $2y$) to a PHC-formatted hash.
+// The conversion is lossless and doesn't need the plain text, so it can be used to migrate stored hashes.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/bcrypt"
+//	)
+//
+//	func main() {
+//	  hash, err := bcrypt.FromMCF("$2y$10$abcdefghijklmnopqrstuu5Lo0g67CiD3M4RpN1BmBb4Crp5w7dbK")
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(hash) // $bcrypt$v=121$r=10$...
+//	}
+func FromMCF(mcf string) (string, error) {
+	deserialize, err := fromMCF([]byte(mcf))
+	if err != nil {
+		return "", err
+	}
+	return format.Serialize(deserialize), nil
+}
+
+// ToMCF converts a PHC-formatted bcrypt hash to the Modular Crypt Format ($2a$, $2b$ or $2y$),
+// for the systems that can only read native bcrypt hashes. It's the reverse of FromMCF.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/bcrypt"
+//	)
+//
+//	func main() {
+//	  mcf, err := bcrypt.ToMCF("$bcrypt$v=98$r=12$Cyzl9S8aUp4MnyfEeAX8SA$wsOAuKL1i3UpyxDwWPT11RRggoQ6evA")
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(mcf) // $2b$12$...
+//	}
+func ToMCF(hash string) (string, error) {
+	if hash == "" {
+		return "", ErrEmptyField
+	}
+	if isSHA256(hash) {
+		return "", fmt.Errorf("%w: bcrypt-sha256 hashes can't be converted to Modular Crypt Format", format.ErrInvalidFormat)
+	}
+
+	deserialize, err := parseHash(hash)
+	if err != nil {
+		return "", err
 	}
 
-	err = bcrypt.CompareHashAndPassword(deserialize.Hash, []byte(plain))
+	mcf, err := toMCF(deserialize)
 	if err != nil {
+		return "", err
+	}
+	return string(mcf), nil
+}
+
+// parseHash deserializes a PHC-formatted bcrypt hash, or converts a bcrypt hash in Modular Crypt Format.
+func parseHash(hash string) (format.PHCConfig, error) {
+	if isMCF(hash) {
+		return fromMCF([]byte(hash))
+	}
+
+	deserialize, err := format.Deserialize(hash)
+	if err != nil {
+		return format.PHCConfig{}, err
+	}
+
+	if deserialize.ID != "bcrypt" {
+		return format.PHCConfig{}, errors.New("hashed string is not a bcrypt instance")
+	}
+	return deserialize, nil
+}
+
+// isMCF reports whether the hash looks like a bcrypt hash in Modular Crypt Format ($2<variant>$).
+func isMCF(hash string) bool {
+	return len(hash) > 4 && hash[0] == '$' && hash[1] == '2' && hash[3] == '$'
+}
+
+// fromMCF converts a bcrypt hash in Modular Crypt Format ($2b$<cost>$<salt><checksum>)
+// to its PHC representation.
+func fromMCF(mcf []byte) (format.PHCConfig, error) {
+	// $2b$12$ followed by 22 characters of salt and 31 characters of checksum
+	if len(mcf) != 60 || mcf[0] != '$' || mcf[1] != '2' || mcf[3] != '$' || mcf[6] != '$' {
+		return format.PHCConfig{}, fmt.Errorf("%w: malformed bcrypt hash", format.ErrInvalidFormat)
+	}
+	if !validVariant(Variant(mcf[2])) {
+		return format.PHCConfig{}, ErrInvalidVariant
+	}
+
+	rounds, err := strconv.Atoi(string(mcf[4:6]))
+	if err != nil || rounds < bcrypt.MinCost || rounds > bcrypt.MaxCost {
+		return format.PHCConfig{}, fmt.Errorf("%w: malformed bcrypt cost", format.ErrInvalidFormat)
+	}
+
+	salt, err := mcfEncoding.DecodeString(string(mcf[7:29]))
+	if err != nil {
+		return format.PHCConfig{}, fmt.Errorf("%w: malformed bcrypt salt", format.ErrInvalidFormat)
+	}
+	checksum, err := mcfEncoding.DecodeString(string(mcf[29:]))
+	if err != nil {
+		return format.PHCConfig{}, fmt.Errorf("%w: malformed bcrypt checksum", format.ErrInvalidFormat)
+	}
+
+	return format.PHCConfig{
+		ID:      "bcrypt",
+		Version: int(mcf[2]),
+		OrderedParams: []format.Param{
+			{Name: "r", Value: rounds},
+		},
+		Salt: salt,
+		Hash: checksum,
+	}, nil
+}
+
+// toMCF converts a deserialized hash to the Modular Crypt Format of bcrypt.
+// Legacy hashes (v=0) already hold it in the hash field.
+func toMCF(deserialize format.PHCConfig) ([]byte, error) {
+	if err := deserialize.CheckParams("r"); err != nil {
+		return nil, err
+	}
+	if len(deserialize.Hash) == 0 {
+		return nil, format.ErrMissingHash
+	}
+	if deserialize.Version == legacyVersion {
+		return deserialize.Hash, nil
+	}
+	if deserialize.Version > 0xff || !validVariant(Variant(deserialize.Version)) {
+		return nil, fmt.Errorf("%w: v=%d", ErrInvalidVariant, deserialize.Version)
+	}
+
+	rounds, err := deserialize.Int("r")
+	if err != nil {
+		return nil, err
+	}
+	if rounds < bcrypt.MinCost || rounds > bcrypt.MaxCost {
+		return nil, fmt.Errorf("%w: r must be between %d and %d", format.ErrInvalidParam, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if len(deserialize.Salt) != saltLength {
+		return nil, fmt.Errorf("%w: salt must be %d bytes", format.ErrInvalidFormat, saltLength)
+	}
+	if len(deserialize.Hash) != checksumLength {
+		return nil, fmt.Errorf("%w: hash must be %d bytes", format.ErrInvalidFormat, checksumLength)
+	}
+
+	mcf := fmt.Sprintf("$2%c$%02d$%s%s", deserialize.Version, rounds, mcfEncoding.EncodeToString(deserialize.Salt), mcfEncoding.EncodeToString(deserialize.Hash))
+	return []byte(mcf), nil
+}
+
+// validVariant reports whether variant is one of the bcrypt variants.
+func validVariant(variant Variant) bool {
+	return variant == A || variant == B || variant == Y
+}
+
+// applyDefaults fills the empty fields of config with the package defaults.
+func applyDefaults(config Config) Config {
+	if config.Rounds <= 0 {
+		config.Rounds = ROUNDS
+	}
+	if config.Variant == 0 {
+		config.Variant = DEFAULT_VARIANT
+	}
+	return config
+}
+
+// Hash creates a PHC-formatted hash with the config. See the package-level Hash function.
+func (c Config) Hash(plain string) (string, error) {
+	return Hash(plain, c)
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided,
+// rejecting hashes whose cost exceeds c.Limits. See the package-level Verify function.
+func (c Config) Verify(hash, plain string) (bool, error) {
+	if hash == "" || plain == "" {
+		return false, ErrEmptyField
+	}
+
+	password := []byte(plain)
+	var mcf []byte
+	if isSHA256(hash) {
+		parsed, err := parseSHA256(hash)
+		if err != nil {
+			return false, err
+		}
+		mcf = parsed.mcf
+		password = prehash(parsed.version, parsed.salt(), plain)
+	} else {
+		deserialize, err := parseHash(hash)
+		if err != nil {
+			return false, err
+		}
+
+		mcf, err = toMCF(deserialize)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	rounds, err := bcrypt.Cost(mcf)
+	if err != nil {
+		return false, err
+	}
+	if err := checkLimits(c.Limits, rounds); err != nil {
+		return false, err
+	}
+
+	err = bcrypt.CompareHashAndPassword(mcf, password)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
 		return false, nil
 	}
+	if err != nil {
+		return false, err
+	}
 	return true, nil
 }
+
+// NeedsRehash checks whether the hash is weaker than the config. See the package-level NeedsRehash function.
+func (c Config) NeedsRehash(hash string) (bool, error) {
+	return NeedsRehash(hash, c)
+}
+
+// UseConfig makes Config a config of phccrypto.Use, which names every parameter the way
+// the algorithm does. It can only be called by the packages of this module.
+func (c Config) UseConfig(sealed.Token) {}
+
+// IDs returns the PHC identifiers of the hashes that this package can verify,
+// and the identifiers of the bcrypt variants in Modular Crypt Format.
+func (c Config) IDs() []string {
+	return []string{"bcrypt", sha256ID, "2a", "2b", "2y"}
+}
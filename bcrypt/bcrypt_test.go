@@ -1,10 +1,15 @@
 package bcrypt_test
 
 import (
+	"encoding/base64"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/aldy505/phc-crypto/format"
 )
 
 func TestHash(t *testing.T) {
@@ -102,3 +107,514 @@ func TestError(t *testing.T) {
 		}
 	})
 }
+
+func TestNeedsRehash(t *testing.T) {
+	hash, err := bcrypt.Hash("password123", bcrypt.Config{Rounds: 5})
+	if err != nil {
+		t.Error(err)
+	}
+
+	t.Run("should return false on the same config", func(t *testing.T) {
+		rehash, err := bcrypt.NeedsRehash(hash, bcrypt.Config{Rounds: 5})
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+	})
+
+	t.Run("should return true on stronger config", func(t *testing.T) {
+		rehash, err := bcrypt.NeedsRehash(hash, bcrypt.Config{Rounds: 6})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should return error", func(t *testing.T) {
+		_, err := bcrypt.NeedsRehash("$bct$v=0$r=32$invalidSalt$invalidHash", bcrypt.Config{})
+		if err == nil || err.Error() != "hashed string is not a bcrypt instance" {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	testCases := []struct {
+		name string
+		hash string
+		err  error
+	}{
+		{"duplicate param", "$bcrypt$v=0$r=4,r=5$$JDJhJDA0JA", format.ErrDuplicateParam},
+		{"unknown param", "$bcrypt$v=0$r=4,x=2$$JDJhJDA0JA", format.ErrUnknownParam},
+		{"missing hash", "$bcrypt$v=0$r=4", format.ErrMissingHash},
+		{"short salt", "$bcrypt$v=98$r=5$cdefghijklmnopqrstuvw$Xxk1HkKHMTJh7QSc0BjoA9iO2PLiR3w", format.ErrInvalidFormat},
+		{"short checksum", "$bcrypt$v=98$r=5$cdefghijklmnopqrstuvww$Xxk1HkKHMTJh7QSc0BjoA9iO2PLiR3", format.ErrInvalidFormat},
+		{"cost out of range", "$bcrypt$v=98$r=32$cdefghijklmnopqrstuvww$Xxk1HkKHMTJh7QSc0BjoA9iO2PLiR3w", format.ErrInvalidParam},
+		{"truncated", "$bcrypt$", format.ErrInvalidFormat},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := bcrypt.Verify(tc.hash, "password123")
+			if !errors.Is(err, tc.err) {
+				t.Error("error should have been thrown:", err)
+			}
+		})
+	}
+
+	t.Run("corrupted hash", func(t *testing.T) {
+		verify, err := bcrypt.Verify("$bcrypt$v=0$r=4$$JDJhJDA0JA", "password123")
+		if err == nil || verify {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func FuzzVerify(f *testing.F) {
+	hash, err := bcrypt.Hash("password123", bcrypt.Config{Rounds: 4})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(hash, "password123")
+	f.Add("$bcrypt$v=0$r=4$$JDJhJDA0JA", "password123")
+	f.Add("$bcrypt$v=0$r=4", "password123")
+	f.Add("$2y$04$N9qo8uLOickgx2ZMRZoMyeM5QvkGKkl3PupXuSSuV94PwE.Qp7N8a", "password123")
+	f.Add("$bcrypt$v=98$r=5$cdefghijklmnopqrstuvww$Xxk1HkKHMTJh7QSc0BjoA9iO2PLiR3w", "password123")
+	f.Add("$bcrypt-sha256$v=2,t=2b,r=4$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly", "password123")
+	f.Add("$bcrypt$", "password123")
+	f.Add("$x$v=1$m$a$b", "password123")
+
+	f.Fuzz(func(t *testing.T, hash string, plain string) {
+		_, _ = bcrypt.Verify(hash, plain)
+		_, _ = bcrypt.NeedsRehash(hash, bcrypt.Config{})
+	})
+}
+
+func TestVerifyLimits(t *testing.T) {
+	t.Run("should reject hashes above the default limits", func(t *testing.T) {
+		// bcrypt of "password123" with a cost of 31, which would take days to verify
+		mcf := base64.RawStdEncoding.EncodeToString([]byte("$2a$31$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"))
+		_, err := bcrypt.Verify("$bcrypt$v=0$r=31$$"+mcf, "password123")
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+
+	t.Run("should enforce the limits of the config", func(t *testing.T) {
+		hash, err := bcrypt.Hash("password123", bcrypt.Config{Rounds: 5})
+		if err != nil {
+			t.Error(err)
+		}
+
+		_, err = bcrypt.Config{Limits: bcrypt.Limits{MaxRounds: 4}}.Verify(hash, "password123")
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("error should have been thrown:", err)
+		}
+
+		verify, err := bcrypt.Config{Limits: bcrypt.Limits{MaxRounds: 5}}.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should hash above the limits", func(t *testing.T) {
+		hash, err := bcrypt.Hash("password123", bcrypt.Config{Rounds: bcrypt.DefaultLimits.MaxRounds + 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(hash, "$bcrypt$v=98$r=17$") {
+			t.Error("unexpected encoding:", hash)
+		}
+
+		_, err = bcrypt.Verify(hash, "password123")
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+
+	t.Run("should refuse costs outside of the range of bcrypt", func(t *testing.T) {
+		configs := []bcrypt.Config{
+			{Rounds: 3},
+			{Rounds: 32},
+			{Rounds: 32, SHA256: true},
+		}
+		for _, config := range configs {
+			_, err := bcrypt.Hash("password123", config)
+			if err == nil || !strings.Contains(err.Error(), "cost") {
+				t.Errorf("%+v: error should have been thrown: %v", config, err)
+			}
+		}
+	})
+}
+
+func TestEncoding(t *testing.T) {
+	t.Run("should encode salt and checksum in their own fields", func(t *testing.T) {
+		hash, err := bcrypt.Hash("password123", bcrypt.Config{Rounds: 4})
+		if err != nil {
+			t.Error(err)
+		}
+		segments := strings.Split(hash, "$")
+		if len(segments) != 6 || segments[1] != "bcrypt" || segments[2] != "v=98" || segments[3] != "r=4" || len(segments[4]) != 22 || len(segments[5]) != 31 {
+			t.Error("unexpected encoding:", hash)
+		}
+
+		hash, err = bcrypt.Hash("password123", bcrypt.Config{Rounds: 4, Variant: bcrypt.Y})
+		if err != nil {
+			t.Error(err)
+		}
+		if !strings.HasPrefix(hash, "$bcrypt$v=121$r=4$") {
+			t.Error("unexpected encoding:", hash)
+		}
+
+		verify, err := bcrypt.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should verify hashes of other implementations", func(t *testing.T) {
+		// $2b$05$abcdefghijklmnopqrstuuVvizFiIFKRHf5OQay/hm.7gM0NJgP1u
+		verify, err := bcrypt.Verify("$bcrypt$v=98$r=5$cdefghijklmnopqrstuvww$Xxk1HkKHMTJh7QSc0BjoA9iO2PLiR3w", "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should verify and rehash legacy hashes", func(t *testing.T) {
+		hash := "$bcrypt$v=0$r=5$$JDJiJDA1JGFiY2RlZmdoaWprbG1ub3BxcnN0dXVWdml6RmlJRktSSGY1T1FheS9obS43Z00wTkpnUDF1"
+		verify, err := bcrypt.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+
+		rehash, err := bcrypt.NeedsRehash(hash, bcrypt.Config{Rounds: 5})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("legacy hash should need rehash")
+		}
+	})
+
+	t.Run("should rehash another variant", func(t *testing.T) {
+		hash := "$bcrypt$v=98$r=5$cdefghijklmnopqrstuvww$Xxk1HkKHMTJh7QSc0BjoA9iO2PLiR3w"
+		rehash, err := bcrypt.NeedsRehash(hash, bcrypt.Config{Rounds: 5})
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+
+		rehash, err = bcrypt.NeedsRehash(hash, bcrypt.Config{Rounds: 5, Variant: bcrypt.A})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should return error on unknown variant", func(t *testing.T) {
+		_, err := bcrypt.Hash("password123", bcrypt.Config{Rounds: 4, Variant: 'x'})
+		if !errors.Is(err, bcrypt.ErrInvalidVariant) {
+			t.Error("error should have been thrown:", err)
+		}
+
+		_, err = bcrypt.Verify("$bcrypt$v=120$r=5$cdefghijklmnopqrstuvww$Xxk1HkKHMTJh7QSc0BjoA9iO2PLiR3w", "password123")
+		if !errors.Is(err, bcrypt.ErrInvalidVariant) {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func TestMCF(t *testing.T) {
+	// generated by crypt(3) of libxcrypt
+	mcf := "$2y$05$N9qo8uLOickgx2ZMRZoMyeM5QvkGKkl3PupXuSSuV94PwE.Qp7N8a"
+
+	t.Run("should verify native hashes", func(t *testing.T) {
+		verify, err := bcrypt.Verify(mcf, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+
+		verify, err = bcrypt.Verify(mcf, "password321")
+		if err != nil {
+			t.Error(err)
+		}
+		if verify {
+			t.Error("verify function returned true")
+		}
+
+		rehash, err := bcrypt.NeedsRehash(mcf, bcrypt.Config{Rounds: 5, Variant: bcrypt.Y})
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+	})
+
+	t.Run("should convert losslessly", func(t *testing.T) {
+		hash, err := bcrypt.FromMCF(mcf)
+		if err != nil {
+			t.Error(err)
+		}
+		if !strings.HasPrefix(hash, "$bcrypt$v=121$r=5$") {
+			t.Error("unexpected encoding:", hash)
+		}
+
+		verify, err := bcrypt.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+
+		back, err := bcrypt.ToMCF(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if back != mcf {
+			t.Error("unexpected conversion:", back)
+		}
+	})
+
+	t.Run("should convert legacy hashes", func(t *testing.T) {
+		back, err := bcrypt.ToMCF("$bcrypt$v=0$r=5$$JDJiJDA1JGFiY2RlZmdoaWprbG1ub3BxcnN0dXVWdml6RmlJRktSSGY1T1FheS9obS43Z00wTkpnUDF1")
+		if err != nil {
+			t.Error(err)
+		}
+		if back != "$2b$05$abcdefghijklmnopqrstuuVvizFiIFKRHf5OQay/hm.7gM0NJgP1u" {
+			t.Error("unexpected conversion:", back)
+		}
+	})
+
+	t.Run("should return error on malformed hashes", func(t *testing.T) {
+		testCases := []struct {
+			name string
+			mcf  string
+			err  error
+		}{
+			{"truncated", "$2y$05$N9qo8uLOickgx2ZMRZoMye", format.ErrInvalidFormat},
+			{"cost", "$2y$aa$N9qo8uLOickgx2ZMRZoMyeM5QvkGKkl3PupXuSSuV94PwE.Qp7N8a", format.ErrInvalidFormat},
+			{"cost out of range", "$2y$03$N9qo8uLOickgx2ZMRZoMyeM5QvkGKkl3PupXuSSuV94PwE.Qp7N8a", format.ErrInvalidFormat},
+			{"alphabet", "$2y$05$N9qo8uLOickgx2ZMRZoMye+5QvkGKkl3PupXuSSuV94PwE.Qp7N8a", format.ErrInvalidFormat},
+			{"variant", "$2x$05$N9qo8uLOickgx2ZMRZoMyeM5QvkGKkl3PupXuSSuV94PwE.Qp7N8a", bcrypt.ErrInvalidVariant},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := bcrypt.FromMCF(tc.mcf)
+				if !errors.Is(err, tc.err) {
+					t.Error("error should have been thrown:", err)
+				}
+
+				_, err = bcrypt.Verify(tc.mcf, "password123")
+				if !errors.Is(err, tc.err) {
+					t.Error("error should have been thrown:", err)
+				}
+			})
+		}
+	})
+}
+
+func TestSHA256(t *testing.T) {
+	long := strings.Repeat("correct horse battery staple ", 4)
+
+	t.Run("should hash and verify passwords longer than 72 bytes", func(t *testing.T) {
+		hash, err := bcrypt.Hash(long, bcrypt.Config{Rounds: 4, SHA256: true})
+		if err != nil {
+			t.Error(err)
+		}
+		if !strings.HasPrefix(hash, "$bcrypt-sha256$v=2,t=2b,r=4$") || len(hash) != 82 {
+			t.Error("unexpected encoding:", hash)
+		}
+
+		verify, err := bcrypt.Verify(hash, long)
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+
+		// the pre-hash must not truncate the password the way bcrypt does
+		verify, err = bcrypt.Verify(hash, long[:72])
+		if err != nil {
+			t.Error(err)
+		}
+		if verify {
+			t.Error("verify function returned true")
+		}
+	})
+
+	t.Run("should verify hashes of passlib", func(t *testing.T) {
+		testCases := []struct {
+			name  string
+			hash  string
+			plain string
+		}{
+			{"v2", "$bcrypt-sha256$v=2,t=2b,r=4$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly", "password123"},
+			{"v2 long password", "$bcrypt-sha256$v=2,t=2b,r=5$N9qo8uLOickgx2ZMRZoMye$jLuESx2YyrERJvk5NjEtHWZ0rN2z2dS", long},
+			{"v1", "$bcrypt-sha256$2a,4$N9qo8uLOickgx2ZMRZoMye$NwnxOYlnV5QzvLtcPfrZsDpr1mj.h4O", "password123"},
+			{"v1 long password", "$bcrypt-sha256$2a,5$N9qo8uLOickgx2ZMRZoMye$TT4bntnmLCQtttIm.s92rw4y63quxYe", long},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				verify, err := bcrypt.Verify(tc.hash, tc.plain)
+				if err != nil {
+					t.Error(err)
+				}
+				if !verify {
+					t.Error("verify function returned false")
+				}
+
+				verify, err = bcrypt.Verify(tc.hash, "password321")
+				if err != nil {
+					t.Error(err)
+				}
+				if verify {
+					t.Error("verify function returned true")
+				}
+			})
+		}
+	})
+
+	t.Run("should rehash between bcrypt and bcrypt-sha256", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			hash   string
+			config bcrypt.Config
+			rehash bool
+		}{
+			{"same config", "$bcrypt-sha256$v=2,t=2b,r=4$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly", bcrypt.Config{Rounds: 4, SHA256: true}, false},
+			{"stronger config", "$bcrypt-sha256$v=2,t=2b,r=4$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly", bcrypt.Config{SHA256: true}, true},
+			{"to bcrypt", "$bcrypt-sha256$v=2,t=2b,r=4$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly", bcrypt.Config{Rounds: 4}, true},
+			{"first version", "$bcrypt-sha256$2a,4$N9qo8uLOickgx2ZMRZoMye$NwnxOYlnV5QzvLtcPfrZsDpr1mj.h4O", bcrypt.Config{Rounds: 4, SHA256: true}, true},
+			{"from bcrypt", "$2b$04$N9qo8uLOickgx2ZMRZoMyeM5QvkGKkl3PupXuSSuV94PwE.Qp7N8a", bcrypt.Config{Rounds: 4, SHA256: true}, true},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				rehash, err := bcrypt.NeedsRehash(tc.hash, tc.config)
+				if err != nil {
+					t.Error(err)
+				}
+				if rehash != tc.rehash {
+					t.Errorf("expected %v, got: %v", tc.rehash, rehash)
+				}
+			})
+		}
+	})
+
+	t.Run("should return error on malformed hashes", func(t *testing.T) {
+		testCases := []struct {
+			name string
+			hash string
+			err  error
+		}{
+			{"missing hash", "$bcrypt-sha256$v=2,t=2b,r=4$N9qo8uLOickgx2ZMRZoMye", format.ErrMissingHash},
+			{"too many fields", "$bcrypt-sha256$v=2,t=2b,r=4$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly$", format.ErrInvalidFormat},
+			{"variant", "$bcrypt-sha256$v=2,t=2a,r=4$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly", format.ErrInvalidParam},
+			{"version", "$bcrypt-sha256$v=3,t=2b,r=4$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly", format.ErrInvalidParam},
+			{"cost", "$bcrypt-sha256$v=2,t=2b,r=x$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly", format.ErrInvalidParam},
+			{"cost out of range", "$bcrypt-sha256$v=2,t=2b,r=3$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly", format.ErrInvalidFormat},
+			{"short checksum", "$bcrypt-sha256$v=2,t=2b,r=4$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVl", format.ErrInvalidFormat},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := bcrypt.Verify(tc.hash, "password123")
+				if !errors.Is(err, tc.err) {
+					t.Errorf("expected %v, got: %v", tc.err, err)
+				}
+			})
+		}
+	})
+
+	t.Run("should return error on other variants", func(t *testing.T) {
+		_, err := bcrypt.Hash("password123", bcrypt.Config{Variant: bcrypt.Y, SHA256: true})
+		if !errors.Is(err, bcrypt.ErrInvalidVariant) {
+			t.Error("expected ErrInvalidVariant, got:", err)
+		}
+	})
+
+	t.Run("should not convert to Modular Crypt Format", func(t *testing.T) {
+		_, err := bcrypt.ToMCF("$bcrypt-sha256$v=2,t=2b,r=4$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly")
+		if !errors.Is(err, format.ErrInvalidFormat) {
+			t.Error("expected ErrInvalidFormat, got:", err)
+		}
+	})
+}
+
+func TestCalibrate(t *testing.T) {
+	t.Run("should stay within the limits", func(t *testing.T) {
+		config, err := bcrypt.Calibrate(20 * time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Rounds < 4 || config.Rounds > bcrypt.DefaultLimits.MaxRounds {
+			t.Errorf("unexpected config: %+v", config)
+		}
+	})
+
+	t.Run("should lower the cost for a short target", func(t *testing.T) {
+		config, err := bcrypt.Calibrate(time.Nanosecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Rounds != 4 {
+			t.Errorf("unexpected config: %+v", config)
+		}
+	})
+
+	t.Run("should return error on invalid target", func(t *testing.T) {
+		if _, err := bcrypt.Calibrate(0); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("expected ErrInvalidParam, got:", err)
+		}
+	})
+}
+
+func TestPresets(t *testing.T) {
+	t.Run("should rehash the hashes below OWASP", func(t *testing.T) {
+		hash, err := bcrypt.Hash("password123", bcrypt.Config{Rounds: 4})
+		if err != nil {
+			t.Error(err)
+		}
+		rehash, err := bcrypt.NeedsRehash(hash, bcrypt.OWASP)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should be within the limits", func(t *testing.T) {
+		if bcrypt.OWASP.Rounds > bcrypt.DefaultLimits.MaxRounds {
+			t.Error("OWASP exceeds the default limits")
+		}
+	})
+}
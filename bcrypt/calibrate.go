@@ -0,0 +1,55 @@
+package bcrypt
+
+import (
+	"time"
+
+	"github.com/aldy505/phc-crypto/internal/calibrate"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// calibrationRounds is the cost that Calibrate measures, long enough to be measured
+// accurately and short enough to be quick.
+const calibrationRounds = 8
+
+// Calibrate benchmarks bcrypt on the host and returns a Config whose hashes take about
+// target to be created. Bcrypt uses a fixed amount of memory, so only the cost is calibrated:
+// it's measured once, and every step of the cost doubles the duration. The cost never
+// exceeds DefaultLimits, so the hashes are accepted by Verify.
+//
+//	import (
+//	  "fmt"
+//	  "time"
+//	  "github.com/aldy505/phc-crypto/bcrypt"
+//	)
+//
+//	func main() {
+//	  config, err := bcrypt.Calibrate(250 * time.Millisecond)
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(config.Rounds) // 12, depending on the host
+//	}
+func Calibrate(target time.Duration) (Config, error) {
+	if err := calibrate.CheckTarget(target); err != nil {
+		return Config{}, err
+	}
+
+	config := Config{Rounds: calibrationRounds}
+	elapsed, err := calibrate.Measure(func() error {
+		_, err := Hash("password", config)
+		return err
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	for elapsed > target && config.Rounds > bcrypt.MinCost {
+		config.Rounds--
+		elapsed /= 2
+	}
+	for elapsed*2 <= target && config.Rounds < DefaultLimits.MaxRounds {
+		config.Rounds++
+		elapsed *= 2
+	}
+	return config, nil
+}
@@ -0,0 +1,147 @@
+package bcrypt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/phc-crypto/format"
+	"golang.org/x/crypto/blowfish"
+)
+
+const (
+	// sha256ID is the identifier of the bcrypt-sha256 hashes of passlib.
+	sha256ID = "bcrypt-sha256"
+	// sha256Version is the version of bcrypt-sha256 created by Hash, which pre-hashes
+	// the password with HMAC-SHA256 keyed by the salt.
+	sha256Version = 2
+	// sha256LegacyVersion is the first version of bcrypt-sha256, which pre-hashes the password with plain SHA-256.
+	sha256LegacyVersion = 1
+)
+
+// magicCipherData is the text that bcrypt encrypts, "OrpheanBeholderScryDoubt".
+var magicCipherData = []byte("OrpheanBeholderScryDoubt")
+
+// sha256Hash is a bcrypt-sha256 hash of passlib, either
+// $bcrypt-sha256$v=2,t=2b,r=<cost>$<salt>$<checksum> or $bcrypt-sha256$<variant>,<cost>$<salt>$<checksum> for the first version.
+type sha256Hash struct {
+	version int
+	// mcf is the bcrypt hash of the pre-hashed password, in Modular Crypt Format.
+	mcf []byte
+}
+
+// isSHA256 reports whether the hash looks like a bcrypt-sha256 hash.
+func isSHA256(hash string) bool {
+	return strings.HasPrefix(hash, "$"+sha256ID+"$")
+}
+
+// parseSHA256 reads a bcrypt-sha256 hash, with the same rules as passlib.
+func parseSHA256(hash string) (sha256Hash, error) {
+	fields := strings.Split(strings.TrimPrefix(hash, "$"+sha256ID+"$"), "$")
+	if len(fields) < 3 {
+		return sha256Hash{}, format.ErrMissingHash
+	}
+	if len(fields) > 3 {
+		return sha256Hash{}, fmt.Errorf("%w: %w", format.ErrInvalidFormat, format.ErrTrailingData)
+	}
+
+	var parsed sha256Hash
+	var variant, rounds string
+	if params, found := strings.CutPrefix(fields[0], "v=2,t="); found {
+		// passlib only creates $2b$ hashes since the second version
+		parsed.version = sha256Version
+		variant, rounds, found = strings.Cut(params, ",r=")
+		if !found || variant != "2b" {
+			return sha256Hash{}, fmt.Errorf("%w: params must be v=2,t=2b,r=<cost>", format.ErrInvalidParam)
+		}
+	} else {
+		parsed.version = sha256LegacyVersion
+		variant, rounds, found = strings.Cut(fields[0], ",")
+		if !found || (variant != "2a" && variant != "2b") {
+			return sha256Hash{}, fmt.Errorf("%w: params must be <variant>,<cost>", format.ErrInvalidParam)
+		}
+	}
+	if len(rounds) < 1 || len(rounds) > 2 || strings.Trim(rounds, "0123456789") != "" {
+		return sha256Hash{}, fmt.Errorf("%w: cost %q is not a decimal", format.ErrInvalidParam, rounds)
+	}
+	if fields[2] == "" {
+		return sha256Hash{}, format.ErrMissingHash
+	}
+
+	cost, _ := strconv.Atoi(rounds)
+	parsed.mcf = []byte(fmt.Sprintf("$%s$%02d$%s%s", variant, cost, fields[1], fields[2]))
+	// validates the cost, the salt and the checksum
+	if _, err := fromMCF(parsed.mcf); err != nil {
+		return sha256Hash{}, err
+	}
+	return parsed, nil
+}
+
+// salt returns the salt of the hash, as encoded in the hash.
+func (h sha256Hash) salt() []byte {
+	return h.mcf[7:29]
+}
+
+// prehash computes the password given to bcrypt by bcrypt-sha256, the base64 of
+// HMAC-SHA256(salt, plain) since the second version, and of SHA-256(plain) before.
+// Its 44 bytes are under the 72 bytes limit of bcrypt, whatever the length of plain is.
+func prehash(version int, salt []byte, plain string) []byte {
+	var digest []byte
+	if version == sha256LegacyVersion {
+		sum := sha256.Sum256([]byte(plain))
+		digest = sum[:]
+	} else {
+		mac := hmac.New(sha256.New, salt)
+		mac.Write([]byte(plain))
+		digest = mac.Sum(nil)
+	}
+
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(digest)))
+	base64.StdEncoding.Encode(encoded, digest)
+	return encoded
+}
+
+// hashSHA256 creates a bcrypt-sha256 hash of the current version.
+// golang.org/x/crypto/bcrypt can't be given a salt, which the pre-hash needs to know,
+// so the bcrypt hash is computed by bcryptSum.
+func hashSHA256(plain string, rounds int) (string, error) {
+	rawSalt := make([]byte, saltLength)
+	if _, err := rand.Read(rawSalt); err != nil {
+		return "", err
+	}
+	salt := mcfEncoding.EncodeToString(rawSalt)
+
+	checksum := bcryptSum(prehash(sha256Version, []byte(salt), plain), rounds, rawSalt)
+	return fmt.Sprintf("$%s$v=%d,t=2b,r=%d$%s$%s", sha256ID, sha256Version, rounds, salt, mcfEncoding.EncodeToString(checksum)), nil
+}
+
+// bcryptSum computes the checksum of bcrypt for the password, the cost and the raw salt,
+// the same as golang.org/x/crypto/bcrypt does internally.
+func bcryptSum(password []byte, rounds int, salt []byte) []byte {
+	// C implementations of bcrypt use the trailing NULL of the key in its expansion
+	key := append(password[:len(password):len(password)], 0)
+
+	c, err := blowfish.NewSaltedCipher(key, salt)
+	if err != nil {
+		// only happens on an empty key or salt, which can't be the case
+		panic(err)
+	}
+	for i := uint64(0); i < 1<<uint(rounds); i++ {
+		blowfish.ExpandKey(key, c)
+		blowfish.ExpandKey(salt, c)
+	}
+
+	cipherData := make([]byte, len(magicCipherData))
+	copy(cipherData, magicCipherData)
+	for i := 0; i < len(cipherData); i += 8 {
+		for j := 0; j < 64; j++ {
+			c.Encrypt(cipherData[i:i+8], cipherData[i:i+8])
+		}
+	}
+	// C implementations of bcrypt only encode 23 of the 24 bytes
+	return cipherData[:checksumLength]
+}
@@ -0,0 +1,67 @@
+package phccrypto
+
+import (
+	"time"
+
+	"github.com/aldy505/phc-crypto/argon2"
+	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/aldy505/phc-crypto/pbkdf2"
+	"github.com/aldy505/phc-crypto/scrypt"
+)
+
+// Calibrate benchmarks the algorithm on the host and returns a Config for Use whose hashes
+// take about target to be created, with up to memoryBudget bytes of memory per hash.
+// Bcrypt and PBKDF2 use a fixed amount of memory, and ignore memoryBudget.
+// PBKDF2 is calibrated with its default hash function, SHA-256.
+// See the Calibrate function of the algorithm package for how the parameters are picked.
+//
+//	config, err := phccrypto.Calibrate(phccrypto.Argon2, 500*time.Millisecond, 64<<20)
+//	if err != nil {
+//		fmt.Println(err)
+//	}
+//
+//	crypto, err := phccrypto.Use(phccrypto.Argon2, config)
+func Calibrate(algo Algorithm, target time.Duration, memoryBudget int) (Config, error) {
+	switch algo {
+	case Scrypt:
+		config, err := scrypt.Calibrate(target, memoryBudget)
+		if err != nil {
+			return Config{}, err
+		}
+		return Config{
+			Cost:        config.Cost,
+			Rounds:      config.Rounds,
+			Parallelism: config.Parallelism,
+		}, nil
+	case Bcrypt:
+		config, err := bcrypt.Calibrate(target)
+		if err != nil {
+			return Config{}, err
+		}
+		return Config{
+			Rounds: config.Rounds,
+		}, nil
+	case Argon2:
+		config, err := argon2.Calibrate(argon2.DEFAULT_VARIANT, target, memoryBudget)
+		if err != nil {
+			return Config{}, err
+		}
+		return Config{
+			Cost:        config.Memory,
+			Rounds:      config.Time,
+			Parallelism: config.Parallelism,
+			Variant:     config.Variant,
+		}, nil
+	case PBKDF2:
+		config, err := pbkdf2.Calibrate(pbkdf2.DEFAULT_HASHFUNCTION, target)
+		if err != nil {
+			return Config{}, err
+		}
+		return Config{
+			Rounds:   config.Rounds,
+			HashFunc: config.HashFunc,
+		}, nil
+	default:
+		return Config{}, ErrAlgoNotSupported
+	}
+}
@@ -0,0 +1,245 @@
+package phccrypto
+
+import (
+	"fmt"
+
+	"github.com/aldy505/phc-crypto/argon2"
+	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/aldy505/phc-crypto/internal/sealed"
+	"github.com/aldy505/phc-crypto/pbkdf2"
+	"github.com/aldy505/phc-crypto/scrypt"
+)
+
+// AlgoConfig is the config given to Use: either Config, the general config shared by the
+// algorithms, or the Config type of the package of the algorithm (argon2.Config, bcrypt.Config,
+// pbkdf2.Config or scrypt.Config). It's sealed, no other type implements it.
+type AlgoConfig interface {
+	UseConfig(sealed.Token)
+}
+
+// UseConfig makes Config a config of Use. It can only be called by the packages of this module.
+func (c Config) UseConfig(sealed.Token) {}
+
+// minSaltLength is the minimum salt length in bytes accepted by Use, as recommended by NIST SP 800-132.
+const minSaltLength = 8
+
+// native converts the general config to the Config of the package of the algorithm.
+// Cost is the memory of argon2 and N of scrypt, while Rounds is the time of argon2
+// and the block size (r) of scrypt.
+func (c Config) native(name Algorithm) (Hasher, error) {
+	switch name {
+	case Scrypt:
+		return scrypt.Config{
+			Cost:        c.Cost,
+			Rounds:      c.Rounds,
+			Parallelism: c.Parallelism,
+			KeyLen:      c.KeyLen,
+			SaltLen:     c.SaltLen,
+		}, nil
+	case Bcrypt:
+		return bcrypt.Config{
+			Rounds: c.Rounds,
+		}, nil
+	case Argon2:
+		return argon2.Config{
+			Time:        c.Rounds,
+			Memory:      c.Cost,
+			Parallelism: c.Parallelism,
+			KeyLen:      c.KeyLen,
+			SaltLen:     c.SaltLen,
+			Variant:     c.Variant,
+		}, nil
+	case PBKDF2:
+		return pbkdf2.Config{
+			Rounds:   c.Rounds,
+			KeyLen:   c.KeyLen,
+			HashFunc: c.HashFunc,
+			SaltLen:  c.SaltLen,
+		}, nil
+	default:
+		return nil, ErrAlgoNotSupported
+	}
+}
+
+// validate checks the config against the legal ranges of the algorithm.
+// Zero fields are left to the defaults of the algorithm.
+func validate(name Algorithm, config AlgoConfig) error {
+	if config == nil {
+		return fmt.Errorf("%w: config must not be nil", ErrInvalidConfig)
+	}
+	if name < Scrypt || name > PBKDF2 {
+		return ErrAlgoNotSupported
+	}
+
+	if general, ok := config.(Config); ok {
+		if err := general.validateFields(name); err != nil {
+			return err
+		}
+		native, err := general.native(name)
+		if err != nil {
+			return err
+		}
+		config = native.(AlgoConfig)
+	}
+
+	switch c := config.(type) {
+	case argon2.Config:
+		if name != Argon2 {
+			return mismatch(name, "argon2")
+		}
+		return validateArgon2(c)
+	case bcrypt.Config:
+		if name != Bcrypt {
+			return mismatch(name, "bcrypt")
+		}
+		return validateBcrypt(c)
+	case pbkdf2.Config:
+		if name != PBKDF2 {
+			return mismatch(name, "pbkdf2")
+		}
+		return validatePBKDF2(c)
+	case scrypt.Config:
+		if name != Scrypt {
+			return mismatch(name, "scrypt")
+		}
+		return validateScrypt(c)
+	default:
+		return fmt.Errorf("%w: unknown config %T", ErrInvalidConfig, config)
+	}
+}
+
+// validateFields checks that the general config only sets the fields that the algorithm uses.
+func (c Config) validateFields(name Algorithm) error {
+	if c.Cost < 0 || c.Rounds < 0 || c.Parallelism < 0 || c.KeyLen < 0 || c.SaltLen < 0 {
+		return fmt.Errorf("%w: fields must not be negative", ErrInvalidConfig)
+	}
+	if c.Variant != argon2.ID && name != Argon2 {
+		return fmt.Errorf("%w: Variant is only used by argon2", ErrInvalidConfig)
+	}
+	if c.HashFunc != pbkdf2.SHA1 && name != PBKDF2 {
+		return fmt.Errorf("%w: HashFunc is only used by pbkdf2", ErrInvalidConfig)
+	}
+
+	switch name {
+	case Bcrypt:
+		if c.Cost != 0 || c.Parallelism != 0 || c.KeyLen != 0 {
+			return fmt.Errorf("%w: bcrypt only uses Rounds", ErrInvalidConfig)
+		}
+		if c.SaltLen != 0 && c.SaltLen != 16 {
+			return fmt.Errorf("%w: bcrypt salt is always 16 bytes, got %d", ErrInvalidConfig, c.SaltLen)
+		}
+	case PBKDF2:
+		if c.Cost != 0 || c.Parallelism != 0 {
+			return fmt.Errorf("%w: pbkdf2 doesn't use Cost nor Parallelism", ErrInvalidConfig)
+		}
+	}
+	return nil
+}
+
+// mismatch returns the error of the Config of an algorithm package given for another algorithm.
+func mismatch(name Algorithm, pkg string) error {
+	return fmt.Errorf("%w: %s.Config can't be used for algorithm %s", ErrInvalidConfig, pkg, name)
+}
+
+// validateArgon2 checks the config against the legal ranges of argon2.
+func validateArgon2(c argon2.Config) error {
+	limits := argon2.DefaultLimits
+	parallelism := c.Parallelism
+	if parallelism == 0 {
+		parallelism = argon2.PARALLELISM
+	}
+
+	switch {
+	case c.Time < 0 || c.Memory < 0 || c.Parallelism < 0 || c.KeyLen < 0 || c.SaltLen < 0:
+		return fmt.Errorf("%w: argon2 parameters must not be negative", ErrInvalidConfig)
+	case c.Variant != argon2.ID && c.Variant != argon2.I && c.Variant != argon2.D:
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, argon2.ErrInvalidVariant)
+	case c.Time > limits.MaxTime:
+		return fmt.Errorf("%w: argon2 time must be at most %d, got %d", ErrInvalidConfig, limits.MaxTime, c.Time)
+	case parallelism > 255 || parallelism > limits.MaxParallelism:
+		return fmt.Errorf("%w: argon2 parallelism must be at most %d, got %d", ErrInvalidConfig, min(255, limits.MaxParallelism), c.Parallelism)
+	case c.Memory != 0 && c.Memory < 8*parallelism:
+		return fmt.Errorf("%w: argon2 memory must be at least %d KiB (8 KiB per lane), got %d", ErrInvalidConfig, 8*parallelism, c.Memory)
+	case c.Memory > limits.MaxMemory:
+		return fmt.Errorf("%w: argon2 memory must be at most %d KiB, got %d", ErrInvalidConfig, limits.MaxMemory, c.Memory)
+	case c.KeyLen != 0 && c.KeyLen < 4:
+		return fmt.Errorf("%w: argon2 key length must be at least 4 bytes, got %d", ErrInvalidConfig, c.KeyLen)
+	case c.KeyProvider != nil && (c.KeyID == "" || len(c.KeyID) > 8):
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, argon2.ErrInvalidKeyID)
+	case len(c.AssociatedData) > 32:
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, argon2.ErrInvalidAssociatedData)
+	}
+	return validateLengths("argon2", c.KeyLen, c.SaltLen, limits.MaxKeyLen, limits.MaxSaltLen)
+}
+
+// validateBcrypt checks the config against the legal ranges of bcrypt.
+func validateBcrypt(c bcrypt.Config) error {
+	switch {
+	case c.Rounds != 0 && (c.Rounds < 4 || c.Rounds > 31):
+		return fmt.Errorf("%w: bcrypt rounds must be between 4 and 31, got %d", ErrInvalidConfig, c.Rounds)
+	case c.Variant != 0 && c.Variant != bcrypt.A && c.Variant != bcrypt.B && c.Variant != bcrypt.Y:
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, bcrypt.ErrInvalidVariant)
+	case c.SHA256 && c.Variant != 0 && c.Variant != bcrypt.B:
+		return fmt.Errorf("%w: bcrypt-sha256 only supports the $2b$ variant", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// validatePBKDF2 checks the config against the legal ranges of pbkdf2.
+func validatePBKDF2(c pbkdf2.Config) error {
+	limits := pbkdf2.DefaultLimits
+
+	switch {
+	case c.Rounds < 0 || c.KeyLen < 0 || c.SaltLen < 0:
+		return fmt.Errorf("%w: pbkdf2 parameters must not be negative", ErrInvalidConfig)
+	case c.HashFunc < pbkdf2.SHA1 || c.HashFunc > pbkdf2.MD5:
+		return fmt.Errorf("%w: unknown pbkdf2 hash function %d", ErrInvalidConfig, c.HashFunc)
+	case c.Dialect != pbkdf2.PHC && c.Dialect != pbkdf2.Passlib:
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, pbkdf2.ErrInvalidDialect)
+	case c.Rounds > limits.MaxRounds:
+		return fmt.Errorf("%w: pbkdf2 rounds must be at most %d, got %d", ErrInvalidConfig, limits.MaxRounds, c.Rounds)
+	}
+	return validateLengths("pbkdf2", c.KeyLen, c.SaltLen, limits.MaxKeyLen, limits.MaxSaltLen)
+}
+
+// validateScrypt checks the config against the legal ranges of scrypt.
+func validateScrypt(c scrypt.Config) error {
+	limits := scrypt.DefaultLimits
+	cost, rounds, parallelism := c.Cost, c.Rounds, c.Parallelism
+	if cost == 0 {
+		cost = scrypt.COST
+	}
+	if rounds == 0 {
+		rounds = scrypt.ROUNDS
+	}
+	if parallelism == 0 {
+		parallelism = scrypt.PARALLELISM
+	}
+
+	switch {
+	case c.Cost < 0 || c.Rounds < 0 || c.Parallelism < 0 || c.KeyLen < 0 || c.SaltLen < 0:
+		return fmt.Errorf("%w: scrypt parameters must not be negative", ErrInvalidConfig)
+	case cost < 2 || cost&(cost-1) != 0:
+		return fmt.Errorf("%w: scrypt cost (N) must be a power of 2 greater than 1, got %d", ErrInvalidConfig, c.Cost)
+	case cost > limits.MaxCost:
+		return fmt.Errorf("%w: scrypt cost (N) must be at most %d, got %d", ErrInvalidConfig, limits.MaxCost, c.Cost)
+	case parallelism > limits.MaxParallelism:
+		return fmt.Errorf("%w: scrypt parallelism must be at most %d, got %d", ErrInvalidConfig, limits.MaxParallelism, c.Parallelism)
+	case rounds > limits.MaxMemory/128/cost:
+		return fmt.Errorf("%w: scrypt memory (128 * N * r) must be at most %d bytes", ErrInvalidConfig, limits.MaxMemory)
+	}
+	return validateLengths("scrypt", c.KeyLen, c.SaltLen, limits.MaxKeyLen, limits.MaxSaltLen)
+}
+
+// validateLengths checks the key and the salt lengths against the limits of the algorithm.
+func validateLengths(algo string, keyLen, saltLen, maxKeyLen, maxSaltLen int) error {
+	switch {
+	case keyLen > maxKeyLen:
+		return fmt.Errorf("%w: %s key length must be at most %d bytes, got %d", ErrInvalidConfig, algo, maxKeyLen, keyLen)
+	case saltLen != 0 && saltLen < minSaltLength:
+		return fmt.Errorf("%w: %s salt length must be at least %d bytes, got %d", ErrInvalidConfig, algo, minSaltLength, saltLen)
+	case saltLen > maxSaltLen:
+		return fmt.Errorf("%w: %s salt length must be at most %d bytes, got %d", ErrInvalidConfig, algo, maxSaltLen, saltLen)
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+// Package django verifies and creates the password hashes of Django (the value of the
+// auth_user.password column), by delegating to the argon2, bcrypt, pbkdf2 and scrypt packages.
+package django
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/phc-crypto/argon2"
+	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/internal/salt"
+	"github.com/aldy505/phc-crypto/pbkdf2"
+	"github.com/aldy505/phc-crypto/scrypt"
+)
+
+// Algorithm is the name of a Django password hasher, which prefixes its hashes.
+type Algorithm string
+
+const (
+	// PBKDF2SHA256 points to PBKDF2PasswordHasher: pbkdf2_sha256$<iterations>$<salt>$<hash>
+	PBKDF2SHA256 Algorithm = "pbkdf2_sha256"
+	// PBKDF2SHA1 points to PBKDF2SHA1PasswordHasher: pbkdf2_sha1$<iterations>$<salt>$<hash>
+	PBKDF2SHA1 Algorithm = "pbkdf2_sha1"
+	// Argon2 points to Argon2PasswordHasher: argon2$argon2id$v=19$m=<memory>,t=<time>,p=<parallelism>$<salt>$<hash>
+	Argon2 Algorithm = "argon2"
+	// BcryptSHA256 points to BCryptSHA256PasswordHasher: bcrypt_sha256$$2b$<cost>$<salt><hash>
+	BcryptSHA256 Algorithm = "bcrypt_sha256"
+	// Bcrypt points to BCryptPasswordHasher: bcrypt$$2b$<cost>$<salt><hash>
+	Bcrypt Algorithm = "bcrypt"
+	// Scrypt points to ScryptPasswordHasher: scrypt$<N>$<salt>$<r>$<p>$<hash>
+	Scrypt Algorithm = "scrypt"
+)
+
+// Config initialize the config require to create a hash function.
+// The config of the algorithm packages are used as they are, except for their empty
+// fields, which are filled with the defaults of Django instead of the package defaults.
+type Config struct {
+	// Algorithm is the Django hasher used by Hash, PBKDF2SHA256 when empty.
+	Algorithm Algorithm
+	PBKDF2    pbkdf2.Config
+	Argon2    argon2.Config
+	Bcrypt    bcrypt.Config
+	Scrypt    scrypt.Config
+}
+
+const (
+	// PBKDF2_ROUNDS is the iterations count of PBKDF2PasswordHasher.
+	PBKDF2_ROUNDS = 600000
+	// ARGON2_TIME is the time cost of Argon2PasswordHasher.
+	ARGON2_TIME = 2
+	// ARGON2_MEMORY is the memory cost (in kilobytes) of Argon2PasswordHasher.
+	ARGON2_MEMORY = 102400
+	// ARGON2_PARALLELISM is the parallelism of Argon2PasswordHasher.
+	ARGON2_PARALLELISM = 8
+	// BCRYPT_ROUNDS is the cost of BCryptSHA256PasswordHasher and BCryptPasswordHasher.
+	BCRYPT_ROUNDS = 12
+	// SCRYPT_COST is the work factor (N) of ScryptPasswordHasher.
+	SCRYPT_COST = 1 << 14
+	// SALT_LENGTH is the length of the salts of Django, in characters.
+	SALT_LENGTH = 22
+)
+
+var ErrEmptyField error = errors.New("function parameters must not be empty")
+var ErrAlgoNotSupported error = errors.New("the algorithm provided is not supported")
+
+// saltChars is the alphabet of the salts of Django (django.utils.crypto.RANDOM_STRING_CHARS).
+const saltChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// Hash creates a Django-formatted hash with config provided
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/django"
+//	)
+//
+//	func main() {
+//	  hash, err := django.Hash("password", django.Config{})
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(hash) // pbkdf2_sha256$600000$Xq3cLk7ZpR2mNvB8sTy4Wd$ViXgnXrmGWSb...
+//	}
+func Hash(plain string, config Config) (string, error) {
+	if plain == "" {
+		return "", ErrEmptyField
+	}
+
+	config = applyDefaults(config)
+
+	switch config.Algorithm {
+	case PBKDF2SHA256, PBKDF2SHA1:
+		hash, err := pbkdf2.Hash(plain, config.PBKDF2)
+		if err != nil {
+			return "", err
+		}
+		deserialize, err := format.Deserialize(hash)
+		if err != nil {
+			return "", err
+		}
+		return string(config.Algorithm) + "$" + strconv.Itoa(config.PBKDF2.Rounds) + "$" + string(deserialize.Salt) + "$" + base64.StdEncoding.EncodeToString(deserialize.Hash), nil
+	case Argon2:
+		hash, err := argon2.Hash(plain, config.Argon2)
+		if err != nil {
+			return "", err
+		}
+		return string(Argon2) + hash, nil
+	case BcryptSHA256, Bcrypt:
+		if config.Algorithm == BcryptSHA256 {
+			plain = prehash(plain)
+		}
+		hash, err := bcrypt.Hash(plain, config.Bcrypt)
+		if err != nil {
+			return "", err
+		}
+		mcf, err := bcrypt.ToMCF(hash)
+		if err != nil {
+			return "", err
+		}
+		return string(config.Algorithm) + "$" + mcf, nil
+	case Scrypt:
+		hash, err := scrypt.Hash(plain, config.Scrypt)
+		if err != nil {
+			return "", err
+		}
+		deserialize, err := format.Deserialize(hash)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s$%d$%s$%d$%d$%s", Scrypt, config.Scrypt.Cost, deserialize.Salt, config.Scrypt.Rounds, config.Scrypt.Parallelism, base64.StdEncoding.EncodeToString(deserialize.Hash)), nil
+	default:
+		return "", ErrAlgoNotSupported
+	}
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided.
+// The algorithm is detected from the prefix of the hash.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/django"
+//	)
+//
+//	func main() {
+//	  hash := "argon2$argon2id$v=19$m=102400,t=2,p=8$Y041dExhNkljRUUy$TMa6A8fPJhCAUXRhJXCXdw"
+//
+//	  verify, err := django.Verify(hash, "secret")
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(verify) // true
+//	}
+func Verify(hash string, plain string) (bool, error) {
+	return Config{}.Verify(hash, plain)
+}
+
+// NeedsRehash checks whether the hash was created with another algorithm than the config provided,
+// or whether the algorithm package reports it as weaker than the config.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/django"
+//	)
+//
+//	func main() {
+//	  hash := "bcrypt$$2b$12$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+//
+//	  rehash, err := django.NeedsRehash(hash, django.Config{Algorithm: django.Argon2})
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(rehash) // true
+//	}
+func NeedsRehash(hash string, config Config) (bool, error) {
+	if hash == "" {
+		return false, ErrEmptyField
+	}
+
+	algorithm, converted, err := convert(hash)
+	if err != nil {
+		return false, err
+	}
+
+	config = applyDefaults(config)
+
+	if algorithm != config.Algorithm {
+		return true, nil
+	}
+
+	switch algorithm {
+	case PBKDF2SHA256, PBKDF2SHA1:
+		return pbkdf2.NeedsRehash(converted, config.PBKDF2)
+	case Argon2:
+		return argon2.NeedsRehash(converted, config.Argon2)
+	case BcryptSHA256, Bcrypt:
+		return bcrypt.NeedsRehash(converted, config.Bcrypt)
+	default:
+		return scrypt.NeedsRehash(converted, config.Scrypt)
+	}
+}
+
+// convert reads the algorithm of a Django hash, and converts the hash to the format
+// of its algorithm package.
+func convert(hash string) (Algorithm, string, error) {
+	prefix, rest, found := strings.Cut(hash, "$")
+	if !found {
+		return "", "", fmt.Errorf("%w: missing algorithm", format.ErrInvalidFormat)
+	}
+
+	algorithm := Algorithm(prefix)
+	switch algorithm {
+	case PBKDF2SHA256, PBKDF2SHA1:
+		fields := strings.Split(rest, "$")
+		if len(fields) != 3 {
+			return "", "", fmt.Errorf("%w: %s hash must have 4 fields", format.ErrInvalidFormat, algorithm)
+		}
+		checksum, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %w", format.ErrInvalidFormat, format.ErrInvalidBase64)
+		}
+		return algorithm, format.Serialize(format.PHCConfig{
+			ID:            strings.Replace(string(algorithm), "_", "", 1),
+			OrderedParams: []format.Param{{Name: "i", Value: fields[0]}},
+			Salt:          []byte(fields[1]),
+			Hash:          checksum,
+		}), nil
+	case Argon2:
+		return algorithm, "$" + rest, nil
+	case BcryptSHA256, Bcrypt:
+		if !strings.HasPrefix(rest, "$2") {
+			return "", "", fmt.Errorf("%w: %s hash must hold a bcrypt hash", format.ErrInvalidFormat, algorithm)
+		}
+		return algorithm, rest, nil
+	case Scrypt:
+		fields := strings.Split(rest, "$")
+		if len(fields) != 5 {
+			return "", "", fmt.Errorf("%w: %s hash must have 6 fields", format.ErrInvalidFormat, algorithm)
+		}
+		cost, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil || cost < 2 || cost&(cost-1) != 0 {
+			return "", "", fmt.Errorf("%w: N must be a power of 2 greater than 1", format.ErrInvalidParam)
+		}
+		checksum, err := base64.StdEncoding.DecodeString(fields[4])
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %w", format.ErrInvalidFormat, format.ErrInvalidBase64)
+		}
+		return algorithm, format.Serialize(format.PHCConfig{
+			ID:          "scrypt",
+			OmitVersion: true,
+			OrderedParams: []format.Param{
+				{Name: "ln", Value: bits.TrailingZeros64(cost)},
+				{Name: "r", Value: fields[2]},
+				{Name: "p", Value: fields[3]},
+			},
+			Salt: []byte(fields[1]),
+			Hash: checksum,
+		}), nil
+	default:
+		return "", "", ErrAlgoNotSupported
+	}
+}
+
+// prehash returns the hex-encoded SHA256 of the plain text, which is what
+// BCryptSHA256PasswordHasher passes to bcrypt.
+func prehash(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// applyDefaults fills the empty fields of config with the defaults of Django.
+func applyDefaults(config Config) Config {
+	if config.Algorithm == "" {
+		config.Algorithm = PBKDF2SHA256
+	}
+
+	if config.PBKDF2.Rounds <= 0 {
+		config.PBKDF2.Rounds = PBKDF2_ROUNDS
+	}
+	if config.PBKDF2.SaltLen <= 0 {
+		config.PBKDF2.SaltLen = SALT_LENGTH
+	}
+	if config.PBKDF2.Rand == nil {
+		config.PBKDF2.Rand = salt.Reader(saltChars)
+	}
+	config.PBKDF2.HashFunc = pbkdf2.SHA256
+	config.PBKDF2.KeyLen = sha256.Size
+	if config.Algorithm == PBKDF2SHA1 {
+		config.PBKDF2.HashFunc = pbkdf2.SHA1
+		config.PBKDF2.KeyLen = 20
+	}
+	config.PBKDF2.Dialect = pbkdf2.PHC
+
+	if config.Argon2.Time <= 0 {
+		config.Argon2.Time = ARGON2_TIME
+	}
+	if config.Argon2.Memory <= 0 {
+		config.Argon2.Memory = ARGON2_MEMORY
+	}
+	if config.Argon2.Parallelism <= 0 {
+		config.Argon2.Parallelism = ARGON2_PARALLELISM
+	}
+	if config.Argon2.KeyLen <= 0 {
+		config.Argon2.KeyLen = 32
+	}
+	if config.Argon2.SaltLen <= 0 {
+		config.Argon2.SaltLen = 16
+	}
+
+	if config.Bcrypt.Rounds <= 0 {
+		config.Bcrypt.Rounds = BCRYPT_ROUNDS
+	}
+
+	if config.Scrypt.Cost <= 0 {
+		config.Scrypt.Cost = SCRYPT_COST
+	}
+	if config.Scrypt.Rounds <= 0 {
+		config.Scrypt.Rounds = 8
+	}
+	if config.Scrypt.Parallelism <= 0 {
+		config.Scrypt.Parallelism = 1
+	}
+	if config.Scrypt.SaltLen <= 0 {
+		config.Scrypt.SaltLen = SALT_LENGTH
+	}
+	if config.Scrypt.Rand == nil {
+		config.Scrypt.Rand = salt.Reader(saltChars)
+	}
+	config.Scrypt.KeyLen = 64
+	return config
+}
+
+// Hash creates a Django-formatted hash with the config. See the package-level Hash function.
+func (c Config) Hash(plain string) (string, error) {
+	return Hash(plain, c)
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided,
+// using the Limits of the algorithm configs. See the package-level Verify function.
+func (c Config) Verify(hash, plain string) (bool, error) {
+	if hash == "" || plain == "" {
+		return false, ErrEmptyField
+	}
+
+	algorithm, converted, err := convert(hash)
+	if err != nil {
+		return false, err
+	}
+
+	switch algorithm {
+	case PBKDF2SHA256, PBKDF2SHA1:
+		return c.PBKDF2.Verify(converted, plain)
+	case Argon2:
+		return c.Argon2.Verify(converted, plain)
+	case BcryptSHA256:
+		return c.Bcrypt.Verify(converted, prehash(plain))
+	case Bcrypt:
+		return c.Bcrypt.Verify(converted, plain)
+	default:
+		return c.Scrypt.Verify(converted, plain)
+	}
+}
+
+// NeedsRehash checks whether the hash is weaker than the config. See the package-level NeedsRehash function.
+func (c Config) NeedsRehash(hash string) (bool, error) {
+	return NeedsRehash(hash, c)
+}
@@ -0,0 +1,193 @@
+package django_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aldy505/phc-crypto/argon2"
+	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/aldy505/phc-crypto/django"
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/pbkdf2"
+	"github.com/aldy505/phc-crypto/scrypt"
+)
+
+// config keeps the costs low, so that the tests run fast.
+var config = django.Config{
+	PBKDF2: pbkdf2.Config{Rounds: 1000},
+	Argon2: argon2.Config{Time: 1, Memory: 1024, Parallelism: 1},
+	Bcrypt: bcrypt.Config{Rounds: 5},
+	Scrypt: scrypt.Config{Cost: 1024},
+}
+
+func TestHash(t *testing.T) {
+	testCases := []struct {
+		algorithm django.Algorithm
+		fields    int
+	}{
+		{django.PBKDF2SHA256, 4},
+		{django.PBKDF2SHA1, 4},
+		{django.Argon2, 6},
+		{django.BcryptSHA256, 5},
+		{django.Bcrypt, 5},
+		{django.Scrypt, 6},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.algorithm), func(t *testing.T) {
+			c := config
+			c.Algorithm = tc.algorithm
+			hash, err := django.Hash("password123", c)
+			if err != nil {
+				t.Error(err)
+			}
+			segments := strings.Split(hash, "$")
+			if len(segments) != tc.fields || segments[0] != string(tc.algorithm) {
+				t.Error("unexpected encoding:", hash)
+			}
+
+			verify, err := django.Verify(hash, "password123")
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false")
+			}
+
+			verify, err = django.Verify(hash, "password")
+			if err != nil {
+				t.Error(err)
+			}
+			if verify {
+				t.Error("verify function returned true")
+			}
+
+			rehash, err := django.NeedsRehash(hash, c)
+			if err != nil {
+				t.Error(err)
+			}
+			if rehash {
+				t.Error("needs rehash function returned true")
+			}
+		})
+	}
+
+	t.Run("should create alphanumeric salts of 22 characters", func(t *testing.T) {
+		hash, err := django.Hash("password123", config)
+		if err != nil {
+			t.Error(err)
+		}
+		salt := strings.Split(hash, "$")[2]
+		if len(salt) != django.SALT_LENGTH || strings.Trim(salt, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") != "" {
+			t.Error("unexpected salt:", salt)
+		}
+	})
+
+	t.Run("should return error if plain is empty", func(t *testing.T) {
+		if _, err := django.Hash("", config); !errors.Is(err, django.ErrEmptyField) {
+			t.Error("expected ErrEmptyField, got:", err)
+		}
+	})
+
+	t.Run("should return error for unknown algorithms", func(t *testing.T) {
+		if _, err := django.Hash("password123", django.Config{Algorithm: "md5"}); !errors.Is(err, django.ErrAlgoNotSupported) {
+			t.Error("expected ErrAlgoNotSupported, got:", err)
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	testCases := []struct {
+		name  string
+		hash  string
+		plain string
+	}{
+		{"pbkdf2_sha256", "pbkdf2_sha256$1000$Xq3cLk7ZpR2mNvB8sTy4Wd$D9hqEfT+Ii6peGPJqeOt0W4reZ2pGQ2VzVyAcYCUvL4=", "password123"},
+		{"pbkdf2_sha1", "pbkdf2_sha1$1000$Xq3cLk7ZpR2mNvB8sTy4Wd$UgKm7s04pKQNzT74misx8RynTKc=", "password123"},
+		{"argon2", "argon2$argon2id$v=19$m=102400,t=2,p=8$Y041dExhNkljRUUy$TMa6A8fPJhCAUXRhJXCXdw", "secret"},
+		{"bcrypt_sha256", "bcrypt_sha256$$2b$05$N9qo8uLOickgx2ZMRZoMye7EgiTcM1D.qupNa3iKFeKnlPxS37RJy", "password123"},
+		{"bcrypt", "bcrypt$$2b$05$N9qo8uLOickgx2ZMRZoMyeM5QvkGKkl3PupXuSSuV94PwE.Qp7N8a", "password123"},
+		{"scrypt", "scrypt$1024$Xq3cLk7ZpR2mNvB8sTy4Wd$8$1$N26Ebk7RnyeOhQoec55mjs8BtDE+aPo2Eitojrb5ekRYV/Xq4dsOYpcPxvPKZMeaIG63fM4WKuVaqhmUPXTD8g==", "password123"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			verify, err := django.Verify(tc.hash, tc.plain)
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false")
+			}
+
+			verify, err = django.Verify(tc.hash, "wrong password")
+			if err != nil {
+				t.Error(err)
+			}
+			if verify {
+				t.Error("verify function returned true")
+			}
+		})
+	}
+
+	t.Run("should apply the limits of the algorithm configs", func(t *testing.T) {
+		c := django.Config{PBKDF2: pbkdf2.Config{Limits: pbkdf2.Limits{MaxRounds: 999}}}
+		_, err := c.Verify(testCases[0].hash, testCases[0].plain)
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("expected ErrLimitExceeded, got:", err)
+		}
+	})
+
+	t.Run("should reject malformed hashes", func(t *testing.T) {
+		malformed := []struct {
+			hash string
+			err  error
+		}{
+			{"", django.ErrEmptyField},
+			{"pbkdf2_sha256", format.ErrInvalidFormat},
+			{"md5$$abc$def", django.ErrAlgoNotSupported},
+			{"pbkdf2_sha256$1000$salt", format.ErrInvalidFormat},
+			{"pbkdf2_sha256$1000$salt$not base64", format.ErrInvalidBase64},
+			{"bcrypt$$1$abc", format.ErrInvalidFormat},
+			{"scrypt$1000$salt$8$1$AAAA", format.ErrInvalidParam},
+			{"scrypt$1024$salt$8$AAAA", format.ErrInvalidFormat},
+		}
+
+		for _, tc := range malformed {
+			if _, err := django.Verify(tc.hash, "password123"); !errors.Is(err, tc.err) {
+				t.Errorf("%q: expected %v, got: %v", tc.hash, tc.err, err)
+			}
+		}
+	})
+}
+
+func TestNeedsRehash(t *testing.T) {
+	t.Run("should need rehash for another algorithm", func(t *testing.T) {
+		rehash, err := django.NeedsRehash("bcrypt$$2b$05$N9qo8uLOickgx2ZMRZoMyeM5QvkGKkl3PupXuSSuV94PwE.Qp7N8a", django.Config{})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should need rehash for weaker parameters", func(t *testing.T) {
+		rehash, err := django.NeedsRehash("pbkdf2_sha256$1000$Xq3cLk7ZpR2mNvB8sTy4Wd$D9hqEfT+Ii6peGPJqeOt0W4reZ2pGQ2VzVyAcYCUvL4=", django.Config{})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+
+		rehash, err = django.NeedsRehash("scrypt$1024$Xq3cLk7ZpR2mNvB8sTy4Wd$8$1$N26Ebk7RnyeOhQoec55mjs8BtDE+aPo2Eitojrb5ekRYV/Xq4dsOYpcPxvPKZMeaIG63fM4WKuVaqhmUPXTD8g==", django.Config{Algorithm: django.Scrypt})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+}
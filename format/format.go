@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -14,59 +15,446 @@ import (
 type PHCConfig struct {
 	ID      string
 	Version int
-	Params  map[string]interface{}
-	Salt    []byte
-	Hash    []byte
+	// OmitVersion leaves the v=<version> segment out of the PHC string, for algorithms
+	// that don't define a version. Deserialize sets it when the PHC string has no version.
+	OmitVersion bool
+	Params      map[string]interface{}
+	// OrderedParams holds parameters that must be serialized in a specific order.
+	// They are written before the ones in Params, which are written sorted by name.
+	// On Deserialize, it contains every parameter in the order they appear in the PHC string.
+	OrderedParams []Param
+	Salt          []byte
+	Hash          []byte
+}
+
+// Param is a single name=value parameter of a PHC string.
+type Param struct {
+	Name  string
+	Value interface{}
 }
 
 var ErrInvalidFormat = errors.New("invalid format")
 
+var (
+	// ErrEmptyValue is returned when a field that must not be empty is empty.
+	ErrEmptyValue = errors.New("empty value")
+	// ErrTooLong is returned when an identifier or a parameter name exceeds 32 characters.
+	ErrTooLong = errors.New("value too long")
+	// ErrInvalidCharacter is returned when a field contains a character that is not allowed by the specification.
+	ErrInvalidCharacter = errors.New("invalid character")
+	// ErrInvalidDecimal is returned when a decimal value is malformed or out of range.
+	ErrInvalidDecimal = errors.New("invalid decimal")
+	// ErrInvalidBase64 is returned when a salt or a hash is not valid unpadded standard base64.
+	ErrInvalidBase64 = errors.New("invalid base64")
+	// ErrTrailingData is returned when there are more fields than the specification allows.
+	ErrTrailingData = errors.New("unexpected trailing data")
+)
+
+var (
+	// ErrMissingParam is returned by the parameter accessors of PHCConfig when the parameter is absent.
+	ErrMissingParam = errors.New("missing parameter")
+	// ErrInvalidParam is returned by the parameter accessors of PHCConfig when the parameter
+	// can't be converted to the requested type or is out of its range.
+	ErrInvalidParam = errors.New("invalid parameter")
+	// ErrDuplicateParam is returned by Deserialize when a parameter appears more than once.
+	ErrDuplicateParam = errors.New("duplicate parameter")
+	// ErrUnknownParam is returned by CheckParams when a parameter is not expected by the algorithm.
+	ErrUnknownParam = errors.New("unknown parameter")
+	// ErrMissingHash is returned when a PHC string has no hash to be verified against.
+	ErrMissingHash = errors.New("missing hash")
+	// ErrLimitExceeded is returned when a parameter of a hash exceeds the limits of the verifier.
+	ErrLimitExceeded = errors.New("parameter exceeds limit")
+)
+
+// maxNameLength is the maximum length of an identifier or a parameter name.
+const maxNameLength = 32
+
+// ParseError describes why a PHC string could not be deserialized.
+// It matches both ErrInvalidFormat and Err with errors.Is.
+type ParseError struct {
+	// Field is the part of the PHC string that is invalid: "id", "version", "params", "salt" or "hash".
+	Field string
+	// Offset is the position (in bytes) of the problem in the PHC string.
+	Offset int
+	// Err is the reason why the field is invalid.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s at offset %d: %s", ErrInvalidFormat, e.Field, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() []error {
+	return []error{ErrInvalidFormat, e.Err}
+}
+
 // Serialize converts PHCConfig struct into a PHC string.
+// Parameters are written in a deterministic order: OrderedParams first, then Params sorted by name.
+// Parameters whose value can't be written in a PHC string are left out, see SerializeStrict.
+// An empty hash is left out, and so is an empty salt that is not followed by a hash.
 // See https://github.com/P-H-C/phc-string-format/blob/master/phc-sf-spec.md
 func Serialize(config PHCConfig) string {
+	phc, _ := serialize(config, false)
+	return phc
+}
+
+// SerializeStrict is like Serialize, but returns an error wrapping ErrInvalidParam instead of
+// leaving out a parameter whose value is not a string, a byte slice, an integer or a fmt.Stringer,
+// or whose string is not a non-empty sequence of [a-zA-Z0-9/+.-]. Nil values are still left out.
+func SerializeStrict(config PHCConfig) (string, error) {
+	return serialize(config, true)
+}
+
+// serialize converts PHCConfig struct into a PHC string. With strict, an invalid parameter
+// value is returned as an error, otherwise the parameter is left out.
+func serialize(config PHCConfig, strict bool) (string, error) {
 	var params []string
-	for key, value := range config.Params {
-		switch v := value.(type) {
-		case string:
-			params = append(params, key+"="+v)
-		case int:
-			params = append(params, key+"="+strconv.Itoa(v))
+	written := make(map[string]bool, len(config.OrderedParams))
+	add := func(name string, value interface{}) error {
+		v, ok := serializeValue(value)
+		if ok {
+			params = append(params, name+"="+v)
+			written[name] = true
+		} else if strict && value != nil {
+			return fmt.Errorf("%w: %s has an invalid value %v of type %T", ErrInvalidParam, name, value, value)
 		}
+		return nil
+	}
+
+	for _, param := range config.OrderedParams {
+		if err := add(param.Name, param.Value); err != nil {
+			return "", err
+		}
+	}
+
+	keys := make([]string, 0, len(config.Params))
+	for key := range config.Params {
+		if !written[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := add(key, config.Params[key]); err != nil {
+			return "", err
+		}
+	}
+
+	phc := "$" + config.ID
+	if !config.OmitVersion {
+		phc += "$v=" + strconv.Itoa(config.Version)
+	}
+	if len(params) > 0 {
+		phc += "$" + strings.Join(params, ",")
+	}
+	// an empty salt is only written when a hash follows it, as Deserialize expects
+	if len(config.Salt) > 0 || len(config.Hash) > 0 {
+		phc += "$" + base64.RawStdEncoding.EncodeToString(config.Salt)
+	}
+	if len(config.Hash) > 0 {
+		phc += "$" + base64.RawStdEncoding.EncodeToString(config.Hash)
+	}
+	return phc, nil
+}
 
+// serializeValue converts a parameter value into its PHC string representation.
+// Integers are written in decimal and byte slices in unpadded standard base64.
+// It returns false for a nil value, for a value of any other type than a string, a byte slice,
+// an integer or a fmt.Stringer, and for a value that is not valid in a PHC string.
+func serializeValue(value interface{}) (string, bool) {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		s = v
+	case []byte:
+		s = base64.RawStdEncoding.EncodeToString(v)
+	case int:
+		s = strconv.FormatInt(int64(v), 10)
+	case int8:
+		s = strconv.FormatInt(int64(v), 10)
+	case int16:
+		s = strconv.FormatInt(int64(v), 10)
+	case int32:
+		s = strconv.FormatInt(int64(v), 10)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case uint:
+		s = strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		s = strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		s = strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		s = strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		s = strconv.FormatUint(v, 10)
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		return "", false
+	}
+	if _, err := validateValue(s); err != nil {
+		return "", false
 	}
-	return "$" + config.ID + "$v=" + strconv.Itoa(config.Version) + "$" + strings.Join(params, ",") + "$" + base64.RawStdEncoding.EncodeToString(config.Salt) + "$" + base64.RawStdEncoding.EncodeToString(config.Hash)
+	return s, true
 }
 
-// Deserialize converts a PHC string into a PHCConfig struct
-func Deserialize(hash string) (PHCConfig, error) {
-	hashArray := strings.Split(hash, "$")
-	params := make(map[string]interface{})
+// param returns the string representation of the parameter name,
+// looking into Params first and OrderedParams second.
+// A parameter whose value can't be written in a PHC string is reported with ErrInvalidParam.
+func (c PHCConfig) param(name string) (string, error) {
+	invalid := false
+	if value, ok := c.Params[name]; ok && value != nil {
+		if v, ok := serializeValue(value); ok {
+			return v, nil
+		}
+		invalid = true
+	}
+	for _, param := range c.OrderedParams {
+		if param.Name == name && param.Value != nil {
+			if v, ok := serializeValue(param.Value); ok {
+				return v, nil
+			}
+			invalid = true
+		}
+	}
+	if invalid {
+		return "", fmt.Errorf("%w: %s has a value of an unsupported type", ErrInvalidParam, name)
+	}
+	return "", fmt.Errorf("%w: %s", ErrMissingParam, name)
+}
 
-	if len(hashArray[3]) != 0 {
-		paramsArray := strings.Split(hashArray[3], ",")
-		for _, value := range paramsArray {
-			pair := strings.Split(value, "=")
-			params[pair[0]] = pair[1]
+// CheckParams returns an error wrapping ErrUnknownParam when the config has a parameter
+// whose name is not one of names.
+func (c PHCConfig) CheckParams(names ...string) error {
+	known := func(name string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
 		}
+		return false
 	}
+	for name := range c.Params {
+		if !known(name) {
+			return fmt.Errorf("%w: %s", ErrUnknownParam, name)
+		}
+	}
+	for _, param := range c.OrderedParams {
+		if !known(param.Name) {
+			return fmt.Errorf("%w: %s", ErrUnknownParam, param.Name)
+		}
+	}
+	return nil
+}
 
-	version, _ := strconv.Atoi(strings.Replace(hashArray[2], "v=", "", 1))
+// String returns the value of the parameter name as a string.
+func (c PHCConfig) String(name string) (string, error) {
+	return c.param(name)
+}
+
+// Int returns the value of the parameter name as a decimal in the 32-bit signed integer range.
+func (c PHCConfig) Int(name string) (int, error) {
+	value, err := c.param(name)
+	if err != nil {
+		return 0, err
+	}
+	v, err := parseDecimal(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s=%s is not a decimal", ErrInvalidParam, name, value)
+	}
+	return v, nil
+}
+
+// Uint32 returns the value of the parameter name as a non-negative decimal that fits in a uint32.
+func (c PHCConfig) Uint32(name string) (uint32, error) {
+	value, err := c.param(name)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" || value[0] == '-' || value[0] == '+' || (value[0] == '0' && len(value) > 1) {
+		return 0, fmt.Errorf("%w: %s=%s is not an unsigned decimal", ErrInvalidParam, name, value)
+	}
+	v, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s=%s is not an unsigned 32-bit decimal", ErrInvalidParam, name, value)
+	}
+	return uint32(v), nil
+}
 
-	salt, err := base64.RawStdEncoding.DecodeString(hashArray[4])
+// Bytes returns the value of the parameter name decoded from unpadded standard base64.
+func (c PHCConfig) Bytes(name string) ([]byte, error) {
+	value, err := c.param(name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := decodeBase64(value)
 	if err != nil {
-		return PHCConfig{}, fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+		return nil, fmt.Errorf("%w: %s=%s is not base64", ErrInvalidParam, name, value)
+	}
+	return v, nil
+}
+
+// Deserialize converts a PHC string into a PHCConfig struct.
+// It follows the grammar of the PHC string format specification:
+//
+//	$<id>[$v=<version>][$<param>=<value>(,<param>=<value>)*][$<salt>[$<hash>]]
+//
+// The salt and the hash are decoded from unpadded standard base64. An empty salt is only
+// accepted when it is followed by a hash. On invalid input, the returned error is a *ParseError.
+func Deserialize(hash string) (PHCConfig, error) {
+	if !strings.HasPrefix(hash, "$") {
+		return PHCConfig{}, &ParseError{Field: "id", Offset: 0, Err: ErrInvalidCharacter}
+	}
+
+	segments := strings.Split(hash[1:], "$")
+	offset := 1
+	config := PHCConfig{
+		Params: make(map[string]interface{}),
+	}
+
+	// next moves to the next segment, keeping track of its offset in the PHC string.
+	next := func() {
+		offset += len(segments[0]) + 1
+		segments = segments[1:]
+	}
+
+	if pos, err := validateName(segments[0]); err != nil {
+		return PHCConfig{}, &ParseError{Field: "id", Offset: offset + pos, Err: err}
+	}
+	config.ID = segments[0]
+	next()
+
+	if len(segments) > 0 && strings.HasPrefix(segments[0], "v=") {
+		version, err := parseDecimal(segments[0][2:])
+		if err != nil || version < 0 {
+			return PHCConfig{}, &ParseError{Field: "version", Offset: offset + 2, Err: ErrInvalidDecimal}
+		}
+		config.Version = version
+		next()
+	} else {
+		config.OmitVersion = true
+	}
+
+	if len(segments) > 0 && strings.Contains(segments[0], "=") {
+		pos := 0
+		for _, pair := range strings.Split(segments[0], ",") {
+			name, value, found := strings.Cut(pair, "=")
+			if p, err := validateName(name); err != nil {
+				return PHCConfig{}, &ParseError{Field: "params", Offset: offset + pos + p, Err: err}
+			}
+			if !found {
+				return PHCConfig{}, &ParseError{Field: "params", Offset: offset + pos + len(name), Err: ErrEmptyValue}
+			}
+			if p, err := validateValue(value); err != nil {
+				return PHCConfig{}, &ParseError{Field: "params", Offset: offset + pos + len(name) + 1 + p, Err: err}
+			}
+			if _, ok := config.Params[name]; ok {
+				return PHCConfig{}, &ParseError{Field: "params", Offset: offset + pos, Err: ErrDuplicateParam}
+			}
+			config.Params[name] = value
+			config.OrderedParams = append(config.OrderedParams, Param{Name: name, Value: value})
+			pos += len(pair) + 1
+		}
+		next()
+	}
+
+	if len(segments) > 0 {
+		if segments[0] == "" && len(segments) == 1 {
+			return PHCConfig{}, &ParseError{Field: "salt", Offset: offset, Err: ErrEmptyValue}
+		}
+		salt, err := decodeBase64(segments[0])
+		if err != nil {
+			return PHCConfig{}, &ParseError{Field: "salt", Offset: offset, Err: err}
+		}
+		config.Salt = salt
+		next()
 	}
 
-	h, err := base64.RawStdEncoding.DecodeString(hashArray[5])
+	if len(segments) > 0 {
+		if segments[0] == "" {
+			return PHCConfig{}, &ParseError{Field: "hash", Offset: offset, Err: ErrEmptyValue}
+		}
+		h, err := decodeBase64(segments[0])
+		if err != nil {
+			return PHCConfig{}, &ParseError{Field: "hash", Offset: offset, Err: err}
+		}
+		config.Hash = h
+		next()
+	}
+
+	if len(segments) > 0 {
+		return PHCConfig{}, &ParseError{Field: "hash", Offset: offset - 1, Err: ErrTrailingData}
+	}
+
+	return config, nil
+}
+
+// validateName checks an identifier or a parameter name, which must be 1 to 32 characters
+// of [a-z0-9-]. On error, it returns the position of the problem in name.
+func validateName(name string) (int, error) {
+	if name == "" {
+		return 0, ErrEmptyValue
+	}
+	if len(name) > maxNameLength {
+		return maxNameLength, ErrTooLong
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return i, ErrInvalidCharacter
+		}
+	}
+	return 0, nil
+}
+
+// validateValue checks a parameter value, which must be a non-empty sequence of [a-zA-Z0-9/+.-].
+// On error, it returns the position of the problem in value.
+func validateValue(value string) (int, error) {
+	if value == "" {
+		return 0, ErrEmptyValue
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '/' || c == '+' || c == '.' || c == '-') {
+			return i, ErrInvalidCharacter
+		}
+	}
+	return 0, nil
+}
+
+// parseDecimal parses a decimal value as described by the specification: an optional minus sign
+// followed by digits, without leading zeros (and without "-0"), in the 32-bit signed integer range.
+func parseDecimal(value string) (int, error) {
+	digits := strings.TrimPrefix(value, "-")
+	if digits == "" || (digits[0] == '0' && (len(digits) > 1 || len(digits) != len(value))) {
+		return 0, ErrInvalidDecimal
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return 0, ErrInvalidDecimal
+		}
+	}
+	v, err := strconv.ParseInt(value, 10, 32)
 	if err != nil {
-		return PHCConfig{}, fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+		return 0, ErrInvalidDecimal
 	}
+	return int(v), nil
+}
 
-	return PHCConfig{
-		ID:      hashArray[1],
-		Version: version,
-		Params:  params,
-		Salt:    salt,
-		Hash:    h,
-	}, nil
+// decodeBase64 decodes unpadded standard base64.
+func decodeBase64(value string) ([]byte, error) {
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '/' || c == '+') {
+			return nil, ErrInvalidBase64
+		}
+	}
+	decoded, err := base64.RawStdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidBase64
+	}
+	return decoded, nil
 }
@@ -2,6 +2,7 @@ package format_test
 
 import (
 	"bytes"
+	"errors"
 	"strings"
 	"testing"
 
@@ -29,7 +30,7 @@ func TestSerialize(t *testing.T) {
 }
 
 func TestDeserialize(t *testing.T) {
-	deserialized, err := format.Deserialize("$argon2id$v=2$Something=New,Somewhere=Far,Meaning=42$U2FsdHlUZXh0$SGFzaHlUZXh0")
+	deserialized, err := format.Deserialize("$argon2id$v=2$something=New,somewhere=Far,meaning=42$U2FsdHlUZXh0$SGFzaHlUZXh0")
 	if err != nil {
 		t.Errorf("unexpected error: %s", err.Error())
 	}
@@ -50,7 +51,443 @@ func TestDeserialize(t *testing.T) {
 		t.Error("Unexpected Hash: ", deserialized.Hash)
 	}
 
-	if deserialized.Params["Something"].(string) != "New" || deserialized.Params["Somewhere"].(string) != "Far" || deserialized.Params["Meaning"].(string) != "42" {
+	if deserialized.Params["something"] != "New" || deserialized.Params["somewhere"] != "Far" || deserialized.Params["meaning"] != "42" {
 		t.Error("Unexpected Params: ", deserialized.Params)
 	}
 }
+
+func TestDeserializeOptionalFields(t *testing.T) {
+	t.Run("should parse without version", func(t *testing.T) {
+		deserialized, err := format.Deserialize("$scrypt$ln=15,r=8,p=1$U2FsdHlUZXh0$SGFzaHlUZXh0")
+		if err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+		}
+		if deserialized.ID != "scrypt" || deserialized.Version != 0 || !deserialized.OmitVersion || deserialized.Params["ln"] != "15" {
+			t.Error("Unexpected output: ", deserialized)
+		}
+
+		serialized := format.Serialize(deserialized)
+		if serialized != "$scrypt$ln=15,r=8,p=1$U2FsdHlUZXh0$SGFzaHlUZXh0" {
+			t.Error("Unexpected output: ", serialized)
+		}
+	})
+
+	t.Run("should parse without params", func(t *testing.T) {
+		deserialized, err := format.Deserialize("$argon2id$v=19$U2FsdHlUZXh0$SGFzaHlUZXh0")
+		if err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+		}
+		if deserialized.Version != 19 || len(deserialized.Params) != 0 || !bytes.Equal(deserialized.Salt, []byte("SaltyText")) {
+			t.Error("Unexpected output: ", deserialized)
+		}
+	})
+
+	t.Run("should parse without salt and hash", func(t *testing.T) {
+		deserialized, err := format.Deserialize("$argon2id$v=19$m=65536,t=2,p=1")
+		if err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+		}
+		if deserialized.Params["m"] != "65536" || deserialized.Salt != nil || deserialized.Hash != nil {
+			t.Error("Unexpected output: ", deserialized)
+		}
+	})
+
+	t.Run("should parse id only", func(t *testing.T) {
+		deserialized, err := format.Deserialize("$argon2id")
+		if err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+		}
+		if deserialized.ID != "argon2id" {
+			t.Error("Unexpected ID: ", deserialized.ID)
+		}
+	})
+
+	t.Run("should parse empty salt followed by a hash", func(t *testing.T) {
+		deserialized, err := format.Deserialize("$bcrypt$v=0$r=12$$SGFzaHlUZXh0")
+		if err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+		}
+		if len(deserialized.Salt) != 0 || !bytes.Equal(deserialized.Hash, []byte("HashyText")) {
+			t.Error("Unexpected output: ", deserialized)
+		}
+	})
+}
+
+func TestDeserializeError(t *testing.T) {
+	testCases := []struct {
+		hash   string
+		field  string
+		offset int
+		err    error
+	}{
+		{"", "id", 0, format.ErrInvalidCharacter},
+		{"argon2id$v=19", "id", 0, format.ErrInvalidCharacter},
+		{"$", "id", 1, format.ErrEmptyValue},
+		{"$Argon2id", "id", 1, format.ErrInvalidCharacter},
+		{"$argon2_id", "id", 7, format.ErrInvalidCharacter},
+		{"$abcdefghijklmnopqrstuvwxyz0123456789", "id", 33, format.ErrTooLong},
+		{"$argon2id$", "salt", 10, format.ErrEmptyValue},
+		{"$argon2id$v=", "version", 12, format.ErrInvalidDecimal},
+		{"$argon2id$v=019", "version", 12, format.ErrInvalidDecimal},
+		{"$argon2id$v=-1", "version", 12, format.ErrInvalidDecimal},
+		{"$argon2id$v=1a", "version", 12, format.ErrInvalidDecimal},
+		{"$argon2id$v=99999999999", "version", 12, format.ErrInvalidDecimal},
+		{"$argon2id$v=19$m=", "params", 17, format.ErrEmptyValue},
+		{"$argon2id$v=19$m=1,=2", "params", 19, format.ErrEmptyValue},
+		{"$argon2id$v=19$m=1,t=2,p", "params", 24, format.ErrEmptyValue},
+		{"$0$0=0,0", "params", 8, format.ErrEmptyValue},
+		{"$argon2id$v=19$m=1,T=2", "params", 19, format.ErrInvalidCharacter},
+		{"$argon2id$v=19$m=1,t=2*", "params", 22, format.ErrInvalidCharacter},
+		{"$argon2id$v=19$m=1,t=2=3", "params", 22, format.ErrInvalidCharacter},
+		{"$argon2id$v=19$m=1$", "salt", 19, format.ErrEmptyValue},
+		{"$argon2id$v=19$m=1$U2Fs.dHk", "salt", 19, format.ErrInvalidBase64},
+		{"$argon2id$v=19$m=1$U2Fsd", "salt", 19, format.ErrInvalidBase64},
+		{"$argon2id$v=19$m=1$U2FsdHk$", "hash", 27, format.ErrEmptyValue},
+		{"$argon2id$v=19$m=1$U2FsdHk$SGFz\naHk", "hash", 27, format.ErrInvalidBase64},
+		{"$argon2id$v=19$m=1$U2FsdHk$SGFzaHk$", "hash", 34, format.ErrTrailingData},
+		{"$x$v=1$m$a$b", "salt", 7, format.ErrInvalidBase64},
+	}
+
+	for _, tc := range testCases {
+		_, err := format.Deserialize(tc.hash)
+
+		var parseErr *format.ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%q: expected a ParseError, got %v", tc.hash, err)
+			continue
+		}
+		if !errors.Is(err, format.ErrInvalidFormat) || !errors.Is(err, tc.err) {
+			t.Errorf("%q: unexpected error: %v", tc.hash, err)
+		}
+		if parseErr.Field != tc.field || parseErr.Offset != tc.offset {
+			t.Errorf("%q: unexpected field or offset: %s at %d", tc.hash, parseErr.Field, parseErr.Offset)
+		}
+	}
+}
+
+func TestSerializeOrder(t *testing.T) {
+	t.Run("should keep the order of ordered params", func(t *testing.T) {
+		config := format.PHCConfig{
+			ID:      "scrypt",
+			Version: 0,
+			OrderedParams: []format.Param{
+				{Name: "ln", Value: 15},
+				{Name: "r", Value: 8},
+				{Name: "p", Value: 1},
+			},
+			Salt: []byte("SaltyText"),
+			Hash: []byte("HashyText"),
+		}
+
+		for i := 0; i < 10; i++ {
+			serialized := format.Serialize(config)
+			if serialized != "$scrypt$v=0$ln=15,r=8,p=1$U2FsdHlUZXh0$SGFzaHlUZXh0" {
+				t.Fatal("Unexpected output: ", serialized)
+			}
+		}
+	})
+
+	t.Run("should sort map params after ordered params", func(t *testing.T) {
+		serialized := format.Serialize(format.PHCConfig{
+			ID: "argon2id",
+			Params: map[string]interface{}{
+				"p":    4,
+				"data": "QUQ",
+				"m":    65536,
+			},
+			OrderedParams: []format.Param{
+				{Name: "m", Value: 65536},
+				{Name: "t", Value: 2},
+			},
+		})
+		if serialized != "$argon2id$v=0$m=65536,t=2,data=QUQ,p=4" {
+			t.Error("Unexpected output: ", serialized)
+		}
+	})
+
+	t.Run("should round trip a config without salt and hash", func(t *testing.T) {
+		testCases := []struct {
+			config format.PHCConfig
+			want   string
+		}{
+			{format.PHCConfig{ID: "argon2id", Version: 19, OrderedParams: []format.Param{{Name: "m", Value: 65536}}}, "$argon2id$v=19$m=65536"},
+			{format.PHCConfig{ID: "argon2id", OmitVersion: true}, "$argon2id"},
+			{format.PHCConfig{ID: "argon2id", Version: 19, Salt: []byte("SaltyText")}, "$argon2id$v=19$U2FsdHlUZXh0"},
+			{format.PHCConfig{ID: "bcrypt", Version: 0, Hash: []byte("HashyText")}, "$bcrypt$v=0$$SGFzaHlUZXh0"},
+		}
+
+		for _, tc := range testCases {
+			serialized := format.Serialize(tc.config)
+			if serialized != tc.want {
+				t.Errorf("unexpected output: got %q, want %q", serialized, tc.want)
+			}
+
+			deserialized, err := format.Deserialize(serialized)
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", serialized, err)
+				continue
+			}
+			if !bytes.Equal(deserialized.Salt, tc.config.Salt) || !bytes.Equal(deserialized.Hash, tc.config.Hash) {
+				t.Errorf("%q: unexpected salt or hash: %v", serialized, deserialized)
+			}
+			if again := format.Serialize(deserialized); again != serialized {
+				t.Errorf("%q: unexpected output after round trip: %q", serialized, again)
+			}
+		}
+	})
+
+	t.Run("should omit empty params", func(t *testing.T) {
+		serialized := format.Serialize(format.PHCConfig{
+			ID:   "argon2id",
+			Salt: []byte("SaltyText"),
+			Hash: []byte("HashyText"),
+		})
+		if serialized != "$argon2id$v=0$U2FsdHlUZXh0$SGFzaHlUZXh0" {
+			t.Error("Unexpected output: ", serialized)
+		}
+	})
+
+	t.Run("should round trip the order through deserialize", func(t *testing.T) {
+		deserialized, err := format.Deserialize("$argon2id$v=19$m=65536,t=2,p=1$U2FsdHlUZXh0$SGFzaHlUZXh0")
+		if err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+		}
+
+		names := ""
+		for _, param := range deserialized.OrderedParams {
+			names += param.Name
+		}
+		if names != "mtp" {
+			t.Error("Unexpected order: ", deserialized.OrderedParams)
+		}
+
+		deserialized.Params = nil
+		if serialized := format.Serialize(deserialized); serialized != "$argon2id$v=19$m=65536,t=2,p=1$U2FsdHlUZXh0$SGFzaHlUZXh0" {
+			t.Error("Unexpected output: ", serialized)
+		}
+	})
+}
+
+func TestSerializeTypes(t *testing.T) {
+	serialized := format.Serialize(format.PHCConfig{
+		ID: "example",
+		OrderedParams: []format.Param{
+			{Name: "a", Value: uint32(4294967295)},
+			{Name: "b", Value: int64(-42)},
+			{Name: "c", Value: uint8(255)},
+			{Name: "d", Value: []byte("SaltyText")},
+			{Name: "e", Value: "value"},
+		},
+		Salt: []byte("SaltyText"),
+		Hash: []byte("HashyText"),
+	})
+	if serialized != "$example$v=0$a=4294967295,b=-42,c=255,d=U2FsdHlUZXh0,e=value$U2FsdHlUZXh0$SGFzaHlUZXh0" {
+		t.Error("Unexpected output: ", serialized)
+	}
+}
+
+type stringer string
+
+func (s stringer) String() string {
+	return string(s)
+}
+
+func TestSerializeInvalidValues(t *testing.T) {
+	config := format.PHCConfig{
+		ID: "example",
+		OrderedParams: []format.Param{
+			{Name: "a", Value: true},
+			{Name: "b", Value: 1.5},
+			{Name: "c", Value: struct{ X int }{1}},
+			{Name: "d", Value: stringer("a,b=c")},
+			{Name: "e", Value: ""},
+			{Name: "f", Value: stringer("v1.0")},
+			{Name: "g", Value: nil},
+		},
+		Salt: []byte("SaltyText"),
+		Hash: []byte("HashyText"),
+	}
+
+	t.Run("should leave invalid values out", func(t *testing.T) {
+		serialized := format.Serialize(config)
+		if serialized != "$example$v=0$f=v1.0$U2FsdHlUZXh0$SGFzaHlUZXh0" {
+			t.Error("Unexpected output: ", serialized)
+		}
+		if _, err := format.Deserialize(serialized); err != nil {
+			t.Error("unexpected error:", err)
+		}
+	})
+
+	t.Run("should return invalid parameter error on strict serialize", func(t *testing.T) {
+		for _, param := range config.OrderedParams[:5] {
+			_, err := format.SerializeStrict(format.PHCConfig{ID: "example", OrderedParams: []format.Param{param}})
+			if !errors.Is(err, format.ErrInvalidParam) {
+				t.Errorf("%s: error should have been thrown: %v", param.Name, err)
+			}
+		}
+
+		serialized, err := format.SerializeStrict(format.PHCConfig{ID: "example", OrderedParams: config.OrderedParams[5:]})
+		if err != nil || serialized != "$example$v=0$f=v1.0" {
+			t.Error("Unexpected output: ", serialized, err)
+		}
+	})
+
+	t.Run("should return invalid parameter error on accessors", func(t *testing.T) {
+		if _, err := config.String("a"); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("error should have been thrown:", err)
+		}
+		if _, err := config.String("g"); !errors.Is(err, format.ErrMissingParam) {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func TestParamAccessors(t *testing.T) {
+	deserialized, err := format.Deserialize("$example$v=1$i=-42,u=4294967295,b=U2FsdHlUZXh0,s=value,z=0,big=4294967296,lead=01,neg=-1$U2FsdHlUZXh0$SGFzaHlUZXh0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	t.Run("should return typed values", func(t *testing.T) {
+		i, err := deserialized.Int("i")
+		if err != nil || i != -42 {
+			t.Error("Unexpected Int: ", i, err)
+		}
+
+		u, err := deserialized.Uint32("u")
+		if err != nil || u != 4294967295 {
+			t.Error("Unexpected Uint32: ", u, err)
+		}
+
+		z, err := deserialized.Uint32("z")
+		if err != nil || z != 0 {
+			t.Error("Unexpected Uint32: ", z, err)
+		}
+
+		b, err := deserialized.Bytes("b")
+		if err != nil || !bytes.Equal(b, []byte("SaltyText")) {
+			t.Error("Unexpected Bytes: ", b, err)
+		}
+
+		s, err := deserialized.String("s")
+		if err != nil || s != "value" {
+			t.Error("Unexpected String: ", s, err)
+		}
+	})
+
+	t.Run("should read values of a config built by hand", func(t *testing.T) {
+		config := format.PHCConfig{
+			Params:        map[string]interface{}{"m": uint32(65536)},
+			OrderedParams: []format.Param{{Name: "p", Value: 4}},
+		}
+
+		m, err := config.Uint32("m")
+		if err != nil || m != 65536 {
+			t.Error("Unexpected Uint32: ", m, err)
+		}
+
+		p, err := config.Int("p")
+		if err != nil || p != 4 {
+			t.Error("Unexpected Int: ", p, err)
+		}
+	})
+
+	t.Run("should return missing parameter error", func(t *testing.T) {
+		if _, err := deserialized.Int("missing"); !errors.Is(err, format.ErrMissingParam) {
+			t.Error("error should have been thrown:", err)
+		}
+		if _, err := deserialized.Uint32("missing"); !errors.Is(err, format.ErrMissingParam) {
+			t.Error("error should have been thrown:", err)
+		}
+		if _, err := deserialized.Bytes("missing"); !errors.Is(err, format.ErrMissingParam) {
+			t.Error("error should have been thrown:", err)
+		}
+		if _, err := deserialized.String("missing"); !errors.Is(err, format.ErrMissingParam) {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+
+	t.Run("should return invalid parameter error", func(t *testing.T) {
+		if _, err := deserialized.Int("s"); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("error should have been thrown:", err)
+		}
+		if _, err := deserialized.Int("big"); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("error should have been thrown:", err)
+		}
+		if _, err := deserialized.Int("lead"); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("error should have been thrown:", err)
+		}
+		if _, err := deserialized.Uint32("big"); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("error should have been thrown:", err)
+		}
+		if _, err := deserialized.Uint32("neg"); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("error should have been thrown:", err)
+		}
+		if _, err := deserialized.Uint32("lead"); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("error should have been thrown:", err)
+		}
+		if _, err := deserialized.Bytes("s"); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func TestDeserializeDuplicate(t *testing.T) {
+	_, err := format.Deserialize("$argon2id$v=19$m=1,t=2,m=3$U2FsdHk$SGFzaHk")
+	var parseErr *format.ParseError
+	if !errors.As(err, &parseErr) || !errors.Is(err, format.ErrDuplicateParam) || parseErr.Offset != 23 {
+		t.Error("error should have been thrown:", err)
+	}
+}
+
+func TestCheckParams(t *testing.T) {
+	deserialized, err := format.Deserialize("$argon2id$v=19$m=1,t=2,p=3$U2FsdHk$SGFzaHk")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if err := deserialized.CheckParams("m", "t", "p", "data"); err != nil {
+		t.Error("unexpected error:", err)
+	}
+
+	if err := deserialized.CheckParams("m", "t"); !errors.Is(err, format.ErrUnknownParam) {
+		t.Error("error should have been thrown:", err)
+	}
+}
+
+func FuzzDeserialize(f *testing.F) {
+	f.Add("$argon2id$v=19$m=65536,t=2,p=1$U2FsdHlUZXh0$SGFzaHlUZXh0")
+	f.Add("$scrypt$ln=15,r=8,p=1$U2FsdHlUZXh0$SGFzaHlUZXh0")
+	f.Add("$bcrypt$v=0$r=12$$SGFzaHlUZXh0")
+	f.Add("$argon2id$v=19$m=1,t=2,m=3")
+	f.Add("$argon2id$")
+	f.Add("$x$v=1$m$a$b")
+	f.Add("$$$$$$")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, hash string) {
+		deserialized, err := format.Deserialize(hash)
+		if err != nil {
+			var parseErr *format.ParseError
+			if !errors.As(err, &parseErr) || !errors.Is(err, format.ErrInvalidFormat) {
+				t.Errorf("unexpected error type: %v", err)
+			}
+			if parseErr != nil && (parseErr.Offset < 0 || parseErr.Offset > len(hash)) {
+				t.Errorf("offset out of range: %v", err)
+			}
+			return
+		}
+
+		if deserialized.ID == "" {
+			t.Errorf("empty ID from %q", hash)
+		}
+		if len(deserialized.Params) != len(deserialized.OrderedParams) {
+			t.Errorf("params mismatch from %q", hash)
+		}
+		for _, param := range deserialized.OrderedParams {
+			if _, err := deserialized.String(param.Name); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,48 @@
+// Package calibrate measures the hash functions on the host, for the Calibrate
+// functions of the algorithm packages.
+package calibrate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aldy505/phc-crypto/format"
+)
+
+// Runs is the number of times that Measure calls the hash function.
+const Runs = 3
+
+// CheckTarget makes sure that the target duration can be calibrated for.
+func CheckTarget(target time.Duration) error {
+	if target <= 0 {
+		return fmt.Errorf("%w: target duration must be positive", format.ErrInvalidParam)
+	}
+	return nil
+}
+
+// Measure returns the fastest of Runs calls of hash, which is the one
+// the least disturbed by the other work of the host.
+func Measure(hash func() error) (time.Duration, error) {
+	var fastest time.Duration
+	for i := 0; i < Runs; i++ {
+		start := time.Now()
+		if err := hash(); err != nil {
+			return 0, err
+		}
+		if elapsed := time.Since(start); i == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+	}
+	return fastest, nil
+}
+
+// Scale returns the cost that fits in target, for a hash function whose duration
+// grows linearly with its cost and took elapsed with the sample cost.
+// The result is clamped between low and high.
+func Scale(sample int, elapsed, target time.Duration, low, high int) int {
+	cost := high
+	if elapsed > 0 && float64(sample)*float64(target)/float64(elapsed) < float64(high) {
+		cost = int(float64(sample) * float64(target) / float64(elapsed))
+	}
+	return max(low, min(cost, high))
+}
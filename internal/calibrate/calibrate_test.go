@@ -0,0 +1,65 @@
+package calibrate_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/internal/calibrate"
+)
+
+func TestScale(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sample  int
+		elapsed time.Duration
+		target  time.Duration
+		cost    int
+	}{
+		{"linear", 1000, 10 * time.Millisecond, 50 * time.Millisecond, 5000},
+		{"rounded down", 1000, 30 * time.Millisecond, 50 * time.Millisecond, 1666},
+		{"below low", 1000, 10 * time.Millisecond, time.Millisecond, 500},
+		{"above high", 1000, time.Millisecond, time.Hour, 1_000_000},
+		{"not measurable", 1000, 0, time.Second, 1_000_000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cost := calibrate.Scale(tc.sample, tc.elapsed, tc.target, 500, 1_000_000)
+			if cost != tc.cost {
+				t.Errorf("expected %d, got: %d", tc.cost, cost)
+			}
+		})
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	t.Run("should call the hash function Runs times", func(t *testing.T) {
+		calls := 0
+		_, err := calibrate.Measure(func() error {
+			calls++
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		if calls != calibrate.Runs {
+			t.Errorf("expected %d calls, got: %d", calibrate.Runs, calls)
+		}
+	})
+
+	t.Run("should return the error of the hash function", func(t *testing.T) {
+		want := errors.New("hash error")
+		_, err := calibrate.Measure(func() error { return want })
+		if !errors.Is(err, want) {
+			t.Error("expected the hash error, got:", err)
+		}
+	})
+
+	t.Run("should reject a target that is not positive", func(t *testing.T) {
+		if err := calibrate.CheckTarget(0); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("expected ErrInvalidParam, got:", err)
+		}
+	})
+}
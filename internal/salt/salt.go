@@ -0,0 +1,27 @@
+// Package salt generates the salts made of the characters of an alphabet,
+// for the adapters of the frameworks that store their salts as text.
+package salt
+
+import "crypto/rand"
+
+// Reader is an io.Reader of random characters of the alphabet it holds,
+// which must have between 1 and 256 characters.
+type Reader string
+
+// Read fills p with random characters of the alphabet.
+func (r Reader) Read(p []byte) (int, error) {
+	var buf [1]byte
+	for i := range p {
+		for {
+			if _, err := rand.Read(buf[:]); err != nil {
+				return i, err
+			}
+			// rejects the bytes that would make the distribution uneven
+			if int(buf[0]) < 256-256%len(r) {
+				p[i] = r[int(buf[0])%len(r)]
+				break
+			}
+		}
+	}
+	return len(p), nil
+}
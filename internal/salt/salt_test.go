@@ -0,0 +1,31 @@
+package salt_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aldy505/phc-crypto/internal/salt"
+)
+
+func TestReader(t *testing.T) {
+	const alphabet = "abc"
+
+	p := make([]byte, 3000)
+	n, err := salt.Reader(alphabet).Read(p)
+	if err != nil || n != len(p) {
+		t.Fatalf("unexpected read: %d, %v", n, err)
+	}
+
+	counts := make(map[byte]int)
+	for _, c := range p {
+		if !strings.ContainsRune(alphabet, rune(c)) {
+			t.Fatalf("unexpected character %q", c)
+		}
+		counts[c]++
+	}
+	for _, c := range []byte(alphabet) {
+		if counts[c] < 800 {
+			t.Errorf("character %q is underrepresented: %d of %d", c, counts[c], len(p))
+		}
+	}
+}
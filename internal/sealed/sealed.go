@@ -0,0 +1,6 @@
+// Package sealed keeps the config interface of phccrypto.Use sealed. Its method takes
+// a Token, which only the packages of this module can name, so no other type implements it.
+package sealed
+
+// Token is the parameter of the method of the config interface of phccrypto.Use.
+type Token struct{}
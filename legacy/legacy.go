@@ -0,0 +1,283 @@
+// Package legacy verifies the hashes of schemes that are too weak to create new hashes with,
+// so that they can be checked once and replaced during a migration:
+// MD5-crypt ($1$), Apache's variant of it ($apr1$), and the salted SHA-1, SHA-512 and MD5
+// schemes of LDAP directories ({SSHA}, {SSHA512} and {SMD5}).
+//
+// The package never creates hashes, and every hash it verifies needs rehash.
+package legacy
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/aldy505/phc-crypto/format"
+)
+
+// Config is the Hasher of the legacy schemes, to be registered with phccrypto.Register.
+// It has no fields, as the parameters of the legacy schemes are fixed.
+type Config struct{}
+
+var ErrEmptyField error = errors.New("function parameters must not be empty")
+var ErrHashNotSupported error = errors.New("legacy schemes can only verify hashes")
+var ErrSchemeNotSupported error = errors.New("the scheme provided is not supported")
+
+const (
+	md5CryptMagic = "$1$"
+	apr1Magic     = "$apr1$"
+	// md5CryptRounds is the fixed rounds count of MD5-crypt.
+	md5CryptRounds = 1000
+	// maxSaltLength is the maximum length of the salt of MD5-crypt, in characters.
+	maxSaltLength = 8
+)
+
+// cryptAlphabet is the base64 alphabet of crypt(3), in which the hash of MD5-crypt is encoded.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// md5CryptOrder is the byte order in which the digest of MD5-crypt is encoded,
+// three bytes (one group of four characters) at a time. The last group holds the remaining byte.
+var md5CryptOrder = []int{0, 6, 12, 1, 7, 13, 2, 8, 14, 3, 9, 15, 4, 10, 5, 11}
+
+// saltedSchemes maps the LDAP schemes to their hash function.
+var saltedSchemes = map[string]func() hash.Hash{
+	"{SSHA}":    sha1.New,
+	"{SSHA512}": sha512.New,
+	"{SMD5}":    md5.New,
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided.
+// The scheme is detected from the prefix of the hash.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/legacy"
+//	)
+//
+//	func main() {
+//	  hash := "$apr1$N9qo8uLO$zRdsB6I/FWxXk/nVwrfRb."
+//
+//	  verify, err := legacy.Verify(hash, "password123")
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(verify) // true
+//	}
+func Verify(hash string, plain string) (bool, error) {
+	if hash == "" || plain == "" {
+		return false, ErrEmptyField
+	}
+
+	if strings.HasPrefix(hash, "{") {
+		return verifySalted(hash, plain)
+	}
+
+	magic, salt, checksum, err := parseCrypt(hash)
+	if err != nil {
+		return false, err
+	}
+
+	verifyHash := md5Crypt(magic, []byte(plain), []byte(salt))
+
+	if subtle.ConstantTimeCompare([]byte(checksum), []byte(verifyHash)) == 1 {
+		return true, nil
+	}
+	return false, nil
+}
+
+// NeedsRehash checks that the hash is one of the legacy schemes, and always reports
+// that it needs rehash, as none of the schemes is fit to keep passwords in.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/legacy"
+//	)
+//
+//	func main() {
+//	  rehash, err := legacy.NeedsRehash("{SSHA}NfXGOurglbemZP/7+M3tqa+/Zn6KHwPCTjlxbw==")
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(rehash) // true
+//	}
+func NeedsRehash(hash string) (bool, error) {
+	if hash == "" {
+		return false, ErrEmptyField
+	}
+
+	var err error
+	if strings.HasPrefix(hash, "{") {
+		_, _, _, err = parseSalted(hash)
+	} else {
+		_, _, _, err = parseCrypt(hash)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// parseCrypt reads the magic, the salt and the hash of a MD5-crypt or apr1 hash.
+func parseCrypt(hash string) (magic, salt, checksum string, err error) {
+	switch {
+	case strings.HasPrefix(hash, md5CryptMagic):
+		magic = md5CryptMagic
+	case strings.HasPrefix(hash, apr1Magic):
+		magic = apr1Magic
+	default:
+		err = ErrSchemeNotSupported
+		return
+	}
+
+	salt, checksum, found := strings.Cut(hash[len(magic):], "$")
+	if !found || strings.Contains(checksum, "$") {
+		err = fmt.Errorf("%w: hash must be formatted as %s<salt>$<hash>", format.ErrInvalidFormat, magic)
+		return
+	}
+	if len(salt) > maxSaltLength {
+		err = fmt.Errorf("%w: salt must be at most %d characters", format.ErrInvalidFormat, maxSaltLength)
+		return
+	}
+	if checksum == "" {
+		err = format.ErrMissingHash
+		return
+	}
+	return
+}
+
+// parseSalted reads the hash function, the digest and the salt of a salted LDAP hash,
+// which is the base64 encoding of the digest followed by the salt.
+// The scheme is case-insensitive, as it is for LDAP.
+func parseSalted(hash string) (newHash func() hash.Hash, digest, salt []byte, err error) {
+	scheme, encoded, found := strings.Cut(hash, "}")
+	if !found {
+		err = fmt.Errorf("%w: hash must be formatted as {<scheme>}<base64>", format.ErrInvalidFormat)
+		return
+	}
+
+	newHash, ok := saltedSchemes[strings.ToUpper(scheme)+"}"]
+	if !ok {
+		err = ErrSchemeNotSupported
+		return
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		err = fmt.Errorf("%w: %w", format.ErrInvalidFormat, format.ErrInvalidBase64)
+		return
+	}
+
+	size := newHash().Size()
+	if len(decoded) <= size {
+		err = fmt.Errorf("%w: hash must hold a digest of %d bytes and a salt", format.ErrInvalidFormat, size)
+		return
+	}
+	return newHash, decoded[:size], decoded[size:], nil
+}
+
+// verifySalted checks a salted LDAP hash, computed as H(plain + salt).
+func verifySalted(hash, plain string) (bool, error) {
+	newHash, digest, salt, err := parseSalted(hash)
+	if err != nil {
+		return false, err
+	}
+
+	h := newHash()
+	h.Write([]byte(plain))
+	h.Write(salt)
+
+	if subtle.ConstantTimeCompare(digest, h.Sum(nil)) == 1 {
+		return true, nil
+	}
+	return false, nil
+}
+
+// md5Crypt computes the encoded hash of the plain text with MD5-crypt, as implemented by
+// FreeBSD's crypt(3). Apache's apr1 is the same algorithm with another magic.
+func md5Crypt(magic string, plain, salt []byte) string {
+	// the alternate digest
+	alt := md5.New()
+	alt.Write(plain)
+	alt.Write(salt)
+	alt.Write(plain)
+	final := alt.Sum(nil)
+
+	ctx := md5.New()
+	ctx.Write(plain)
+	ctx.Write([]byte(magic))
+	ctx.Write(salt)
+	for n := len(plain); n > 0; n -= md5.Size {
+		ctx.Write(final[:min(n, md5.Size)])
+	}
+	for n := len(plain); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(plain[:1])
+		}
+	}
+	final = ctx.Sum(nil)
+
+	// the rounds, which are meant to slow it down
+	for i := 0; i < md5CryptRounds; i++ {
+		ctx.Reset()
+		if i&1 != 0 {
+			ctx.Write(plain)
+		} else {
+			ctx.Write(final)
+		}
+		if i%3 != 0 {
+			ctx.Write(salt)
+		}
+		if i%7 != 0 {
+			ctx.Write(plain)
+		}
+		if i&1 != 0 {
+			ctx.Write(final)
+		} else {
+			ctx.Write(plain)
+		}
+		final = ctx.Sum(final[:0])
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(md5CryptOrder); i += 3 {
+		group := md5CryptOrder[i:min(i+3, len(md5CryptOrder))]
+		var w uint
+		for _, idx := range group {
+			w = w<<8 | uint(final[idx])
+		}
+		for n := len(group) + 1; n > 0; n-- {
+			sb.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	return sb.String()
+}
+
+// Hash refuses to create a hash, as the legacy schemes can only be verified.
+func (c Config) Hash(plain string) (string, error) {
+	return "", ErrHashNotSupported
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided.
+// See the package-level Verify function.
+func (c Config) Verify(hash, plain string) (bool, error) {
+	return Verify(hash, plain)
+}
+
+// NeedsRehash always reports that a legacy hash needs rehash. See the package-level NeedsRehash function.
+func (c Config) NeedsRehash(hash string) (bool, error) {
+	return NeedsRehash(hash)
+}
+
+// IDs returns the identifiers of the hashes that this package can verify.
+// The LDAP schemes are identified with their braces.
+func (c Config) IDs() []string {
+	return []string{"1", "apr1", "{SSHA}", "{SSHA512}", "{SMD5}"}
+}
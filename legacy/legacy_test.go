@@ -0,0 +1,109 @@
+package legacy_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/legacy"
+)
+
+func TestVerify(t *testing.T) {
+	testCases := []struct {
+		name  string
+		hash  string
+		plain string
+	}{
+		{"md5-crypt", "$1$N9qo8uLO$FJZzzotYdygzbuLycG/nL.", "password123"},
+		{"md5-crypt long plain", "$1$saltstri$YMyguxXMBpd2TEZ.vS/3q1", "Hello world!"},
+		{"apr1", "$apr1$N9qo8uLO$zRdsB6I/FWxXk/nVwrfRb.", "password123"},
+		{"apr1 long plain", "$apr1$saltstri$aGfuB7Lcvs2TUeFTqUVfN0", "Hello world!"},
+		{"ssha", "{SSHA}NfXGOurglbemZP/7+M3tqa+/Zn6KHwPCTjlxbw==", "password123"},
+		{"ssha512", "{SSHA512}Z87pLDarOj88eNpR1qPURHDT2I563T1zMtQ08mpWnO9LKvzju1/HzBn9YoqykftgtsaM+WsiKtH0ytANHh0S/IofA8JOOXFv", "password123"},
+		{"smd5", "{SMD5}txeSHKBuqCggDj+x4KnMzoofA8JOOXFv", "password123"},
+		{"lower case scheme", "{ssha}NfXGOurglbemZP/7+M3tqa+/Zn6KHwPCTjlxbw==", "password123"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			verify, err := legacy.Verify(tc.hash, tc.plain)
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false")
+			}
+
+			verify, err = legacy.Verify(tc.hash, "password321")
+			if err != nil {
+				t.Error(err)
+			}
+			if verify {
+				t.Error("verify function returned true")
+			}
+		})
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	testCases := []struct {
+		name string
+		hash string
+		err  error
+	}{
+		{"empty", "", legacy.ErrEmptyField},
+		{"unknown crypt scheme", "$5$saltstring$5B8vYYiY", legacy.ErrSchemeNotSupported},
+		{"unknown ldap scheme", "{CRYPT}$1$N9qo8uLO$FJZzzotYdygzbuLycG/nL.", legacy.ErrSchemeNotSupported},
+		{"missing hash", "$1$N9qo8uLO$", format.ErrMissingHash},
+		{"missing salt separator", "$1$N9qo8uLO", format.ErrInvalidFormat},
+		{"too many fields", "$apr1$N9qo8uLO$zRdsB6I$", format.ErrInvalidFormat},
+		{"salt too long", "$1$N9qo8uLOi$FJZzzotYdygzbuLycG/nL.", format.ErrInvalidFormat},
+		{"missing brace", "{SSHA", format.ErrInvalidFormat},
+		{"invalid base64", "{SSHA}not base64", format.ErrInvalidBase64},
+		{"missing salt", "{SMD5}txeSHKBuqCggDj+x4KnMzg==", format.ErrInvalidFormat},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := legacy.Verify(tc.hash, "password123")
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	t.Run("should always return true", func(t *testing.T) {
+		for _, hash := range []string{"$1$N9qo8uLO$FJZzzotYdygzbuLycG/nL.", "{SMD5}txeSHKBuqCggDj+x4KnMzoofA8JOOXFv"} {
+			rehash, err := legacy.NeedsRehash(hash)
+			if err != nil {
+				t.Error(err)
+			}
+			if !rehash {
+				t.Error("needs rehash function returned false for", hash)
+			}
+		}
+	})
+
+	t.Run("should return error on malformed hashes", func(t *testing.T) {
+		if _, err := legacy.NeedsRehash(""); !errors.Is(err, legacy.ErrEmptyField) {
+			t.Error("expected ErrEmptyField, got:", err)
+		}
+		if _, err := legacy.NeedsRehash("$argon2id$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA"); !errors.Is(err, legacy.ErrSchemeNotSupported) {
+			t.Error("expected ErrSchemeNotSupported, got:", err)
+		}
+	})
+}
+
+func TestHash(t *testing.T) {
+	t.Run("should refuse to create hashes", func(t *testing.T) {
+		hash, err := legacy.Config{}.Hash("password123")
+		if !errors.Is(err, legacy.ErrHashNotSupported) {
+			t.Error("expected ErrHashNotSupported, got:", err)
+		}
+		if hash != "" {
+			t.Error("hash should be empty:", hash)
+		}
+	})
+}
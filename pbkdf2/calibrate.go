@@ -0,0 +1,50 @@
+package pbkdf2
+
+import (
+	"time"
+
+	"github.com/aldy505/phc-crypto/internal/calibrate"
+)
+
+const (
+	// calibrationRounds is the iteration count that Calibrate measures.
+	calibrationRounds = 10000
+	// minCalibratedRounds is the least iteration count that Calibrate returns, as recommended by RFC 8018.
+	minCalibratedRounds = 1000
+)
+
+// Calibrate benchmarks PBKDF2 with the hash function on the host and returns a Config
+// whose hashes take about target to be created. PBKDF2 uses a fixed amount of memory,
+// so only the iteration count is calibrated, which the duration grows linearly with.
+// The iteration count never exceeds DefaultLimits, so the hashes are accepted by Verify.
+//
+//	import (
+//	  "fmt"
+//	  "time"
+//	  "github.com/aldy505/phc-crypto/pbkdf2"
+//	)
+//
+//	func main() {
+//	  config, err := pbkdf2.Calibrate(pbkdf2.SHA256, 250*time.Millisecond)
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(config.Rounds) // 600000, depending on the host
+//	}
+func Calibrate(hashFunc HashFunction, target time.Duration) (Config, error) {
+	if err := calibrate.CheckTarget(target); err != nil {
+		return Config{}, err
+	}
+
+	config := Config{Rounds: calibrationRounds, HashFunc: hashFunc}
+	elapsed, err := calibrate.Measure(func() error {
+		_, err := Hash("password", config)
+		return err
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	config.Rounds = calibrate.Scale(config.Rounds, elapsed, target, minCalibratedRounds, DefaultLimits.MaxRounds)
+	return config, nil
+}
@@ -7,12 +7,15 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
 
 	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/internal/sealed"
 	"golang.org/x/crypto/pbkdf2"
 )
 
@@ -22,6 +25,33 @@ type Config struct {
 	KeyLen   int
 	HashFunc HashFunction
 	SaltLen  int
+	// Dialect is the encoding of the hashes created by Hash. Verify accepts both.
+	Dialect Dialect
+	// Rand is the source of the salt, crypto/rand.Reader when nil.
+	Rand io.Reader
+	// Limits caps the parameters of the hashes accepted by Verify.
+	// Empty fields fall back to DefaultLimits.
+	Limits Limits
+}
+
+// Limits caps the parameters that Verify accepts from a hash, so that a hash with
+// a hostile iteration count can't pin the CPU of the verifier.
+// The check is done before any hashing work starts, and a hash that exceeds
+// any of the limits is rejected with format.ErrLimitExceeded.
+type Limits struct {
+	// MaxRounds is the maximum iteration count (i)
+	MaxRounds int
+	// MaxKeyLen is the maximum length of the hash in bytes
+	MaxKeyLen int
+	// MaxSaltLen is the maximum length of the salt in bytes
+	MaxSaltLen int
+}
+
+// DefaultLimits are the limits used by Verify, and by Config.Verify for the empty fields of Config.Limits.
+var DefaultLimits = Limits{
+	MaxRounds:  5_000_000,
+	MaxKeyLen:  256,
+	MaxSaltLen: 1024,
 }
 
 const (
@@ -46,8 +76,49 @@ const (
 	MD5
 )
 
+// The presets are the iteration counts of the OWASP Password Storage Cheat Sheet for
+// PBKDF2-HMAC, which are far above ROUNDS.
+var (
+	// OWASPSHA256 is PBKDF2-HMAC-SHA256 with 600,000 iterations.
+	OWASPSHA256 = Config{
+		Rounds:   600_000,
+		KeyLen:   32,
+		HashFunc: SHA256,
+		SaltLen:  16,
+	}
+	// OWASPSHA512 is PBKDF2-HMAC-SHA512 with 210,000 iterations.
+	OWASPSHA512 = Config{
+		Rounds:   210_000,
+		KeyLen:   64,
+		HashFunc: SHA512,
+		SaltLen:  16,
+	}
+)
+
+// Dialect sets up enum for available encodings of PBKDF2 hashes
+type Dialect int
+
+const (
+	// PHC is the encoding of this package: $pbkdf2sha256$v=0$i=4096$<salt>$<hash>
+	PHC Dialect = iota
+	// Passlib is the encoding of passlib: $pbkdf2-sha256$4096$<salt>$<hash>, with the salt and the hash
+	// in adapted base64 ('.' instead of '+'). It's only defined for SHA1, SHA256 and SHA512.
+	Passlib
+)
+
 var ErrEmptyField error = errors.New("function parameters must not be empty")
 var ErrInvalidHashFunction error = errors.New("invalid hash function was provided")
+var ErrInvalidDialect error = errors.New("invalid pbkdf2 dialect")
+
+// passlibHashFuncs maps the identifiers of passlib to their hash function.
+var passlibHashFuncs = map[string]HashFunction{
+	"pbkdf2":        SHA1,
+	"pbkdf2-sha256": SHA256,
+	"pbkdf2-sha512": SHA512,
+}
+
+// ab64Encoding is the adapted base64 of passlib, which uses '.' instead of '+' and no padding.
+var ab64Encoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789./").WithPadding(base64.NoPadding)
 
 func hashFuncToName(h HashFunction) string {
 	switch h {
@@ -68,7 +139,8 @@ func hashFuncToName(h HashFunction) string {
 	}
 }
 
-// Hash creates a PHC-formatted hash with config provided
+// Hash creates a PHC-formatted hash with config provided, or a passlib-formatted one
+// when config.Dialect is Passlib.
 //
 //	import (
 //	  "fmt"
@@ -89,22 +161,20 @@ func Hash(plain string, config Config) (string, error) {
 		return "", ErrEmptyField
 	}
 
-	if config.Rounds <= 0 {
-		config.Rounds = ROUNDS
-	}
-	if config.KeyLen <= 0 {
-		config.KeyLen = KEY_LENGTH
-	}
-	if config.HashFunc < 0 || config.HashFunc > 5 {
-		config.HashFunc = DEFAULT_HASHFUNCTION
+	config = applyDefaults(config)
+
+	if config.Dialect != PHC && config.Dialect != Passlib {
+		return "", ErrInvalidDialect
 	}
-	if config.SaltLen <= 0 {
-		config.SaltLen = SALT_LENGTH
+	if config.Dialect == Passlib && passlibID(config.HashFunc) == "" {
+		return "", ErrInvalidHashFunction
 	}
 
 	// minimum 64 bits, 128 bits is recommended
 	salt := make([]byte, config.SaltLen)
-	io.ReadFull(rand.Reader, salt)
+	if _, err := io.ReadFull(config.Rand, salt); err != nil {
+		return "", fmt.Errorf("reading random reader: %w", err)
+	}
 
 	var hash []byte
 
@@ -123,10 +193,14 @@ func Hash(plain string, config Config) (string, error) {
 		hash = pbkdf2.Key([]byte(plain), salt, config.Rounds, config.KeyLen, md5.New)
 	}
 
+	if config.Dialect == Passlib {
+		return "$" + passlibID(config.HashFunc) + "$" + strconv.Itoa(config.Rounds) + "$" + ab64Encoding.EncodeToString(salt) + "$" + ab64Encoding.EncodeToString(hash), nil
+	}
+
 	hashString := format.Serialize(format.PHCConfig{
 		ID: "pbkdf2" + hashFuncToName(config.HashFunc),
-		Params: map[string]interface{}{
-			"i": config.Rounds,
+		OrderedParams: []format.Param{
+			{Name: "i", Value: config.Rounds},
 		},
 		Salt: salt[:],
 		Hash: hash[:],
@@ -136,6 +210,7 @@ func Hash(plain string, config Config) (string, error) {
 }
 
 // Verify checks the hash if it's equal (by an algorithm) to plain text provided.
+// It accepts the hashes of passlib ($pbkdf2$, $pbkdf2-sha256$ and $pbkdf2-sha512$) as well.
 //
 //	import (
 //	  "fmt"
@@ -152,26 +227,218 @@ func Hash(plain string, config Config) (string, error) {
 //	  fmt.Println(verify) // true
 //	}
 func Verify(hash string, plain string) (bool, error) {
-	if hash == "" || plain == "" {
+	return Config{}.Verify(hash, plain)
+}
+
+// NeedsRehash checks whether the hash was created with a different hash function or dialect,
+// or with weaker parameters (rounds, salt length or key length) than the config provided.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/pbkdf2"
+//	)
+//
+//	func main() {
+//	  hash := "$pbkdf2sha512$v=0$i=4096$87a39b3cf30626bc7cf6534ac3a14ddf$d32093416bf521ff0..."
+//
+//	  rehash, err := pbkdf2.NeedsRehash(hash, pbkdf2.Config{HashFunc: pbkdf2.SHA512, Rounds: 10000})
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(rehash) // true
+//	}
+func NeedsRehash(hash string, config Config) (bool, error) {
+	if hash == "" {
 		return false, ErrEmptyField
 	}
 
-	deserialize, err := format.Deserialize(hash)
+	deserialize, dialect, err := parseHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	config = applyDefaults(config)
+
+	if config.Dialect != PHC && config.Dialect != Passlib {
+		return false, ErrInvalidDialect
+	}
+
+	if deserialize.ID != "pbkdf2"+hashFuncToName(config.HashFunc) || dialect != config.Dialect {
+		return true, nil
+	}
+
+	rounds, err := parseParams(deserialize)
 	if err != nil {
 		return false, err
 	}
 
+	return rounds < config.Rounds ||
+		len(deserialize.Salt) < config.SaltLen ||
+		len(deserialize.Hash) < config.KeyLen, nil
+}
+
+// parseHash deserializes a PHC-formatted or a passlib-formatted pbkdf2 hash. Passlib hashes are
+// converted to their PHC representation, so they can be verified the same way.
+func parseHash(hash string) (format.PHCConfig, Dialect, error) {
+	segments := strings.Split(hash, "$")
+	if len(segments) > 1 && segments[0] == "" {
+		if hashFunc, ok := passlibHashFuncs[segments[1]]; ok {
+			deserialize, err := parsePasslib(segments[2:], hashFunc)
+			return deserialize, Passlib, err
+		}
+	}
+
+	deserialize, err := format.Deserialize(hash)
+	if err != nil {
+		return format.PHCConfig{}, PHC, err
+	}
+
 	if !strings.HasPrefix(deserialize.ID, "pbkdf2") {
-		return false, errors.New("hashed string is not pbkdf2 instance")
+		return format.PHCConfig{}, PHC, errors.New("hashed string is not pbkdf2 instance")
+	}
+	return deserialize, PHC, nil
+}
+
+// parsePasslib converts the fields of a passlib hash (rounds, salt and checksum) to the PHC representation.
+func parsePasslib(fields []string, hashFunc HashFunction) (format.PHCConfig, error) {
+	if len(fields) < 3 {
+		return format.PHCConfig{}, format.ErrMissingHash
+	}
+	if len(fields) > 3 {
+		return format.PHCConfig{}, fmt.Errorf("%w: %w", format.ErrInvalidFormat, format.ErrTrailingData)
+	}
+
+	rounds := fields[0]
+	if rounds == "" || strings.Trim(rounds, "0123456789") != "" || rounds[0] == '0' {
+		return format.PHCConfig{}, fmt.Errorf("%w: rounds %q is not a decimal", format.ErrInvalidParam, rounds)
+	}
+
+	salt, err := ab64Encoding.DecodeString(fields[1])
+	if err != nil {
+		return format.PHCConfig{}, fmt.Errorf("%w: %w", format.ErrInvalidFormat, format.ErrInvalidBase64)
+	}
+	hash, err := ab64Encoding.DecodeString(fields[2])
+	if err != nil {
+		return format.PHCConfig{}, fmt.Errorf("%w: %w", format.ErrInvalidFormat, format.ErrInvalidBase64)
+	}
+
+	return format.PHCConfig{
+		ID:            "pbkdf2" + hashFuncToName(hashFunc),
+		Params:        map[string]interface{}{"i": rounds},
+		OrderedParams: []format.Param{{Name: "i", Value: rounds}},
+		Salt:          salt,
+		Hash:          hash,
+	}, nil
+}
+
+// passlibID returns the passlib identifier of the hash function, or an empty string
+// when passlib doesn't define one.
+func passlibID(hashFunc HashFunction) string {
+	for id, h := range passlibHashFuncs {
+		if h == hashFunc {
+			return id
+		}
+	}
+	return ""
+}
+
+// parseParams reads the parameters of a deserialized hash, making sure that
+// there are no unknown parameters and that the values are usable by pbkdf2.
+func parseParams(deserialize format.PHCConfig) (rounds int, err error) {
+	if err = deserialize.CheckParams("i"); err != nil {
+		return
 	}
 
+	rounds, err = deserialize.Int("i")
+	if err != nil {
+		return
+	}
+	if rounds < 1 {
+		err = fmt.Errorf("%w: i must be at least 1", format.ErrInvalidParam)
+		return
+	}
+	return
+}
+
+// checkLimits makes sure that none of the parameters of a hash exceeds the limits.
+func checkLimits(limits Limits, rounds, saltLen, keyLen int) error {
+	limits = applyDefaultLimits(limits)
+	switch {
+	case rounds > limits.MaxRounds:
+		return fmt.Errorf("%w: i=%d is above %d", format.ErrLimitExceeded, rounds, limits.MaxRounds)
+	case saltLen > limits.MaxSaltLen:
+		return fmt.Errorf("%w: salt length %d is above %d", format.ErrLimitExceeded, saltLen, limits.MaxSaltLen)
+	case keyLen > limits.MaxKeyLen:
+		return fmt.Errorf("%w: key length %d is above %d", format.ErrLimitExceeded, keyLen, limits.MaxKeyLen)
+	}
+	return nil
+}
+
+// applyDefaultLimits fills the empty fields of limits with DefaultLimits.
+func applyDefaultLimits(limits Limits) Limits {
+	if limits.MaxRounds <= 0 {
+		limits.MaxRounds = DefaultLimits.MaxRounds
+	}
+	if limits.MaxKeyLen <= 0 {
+		limits.MaxKeyLen = DefaultLimits.MaxKeyLen
+	}
+	if limits.MaxSaltLen <= 0 {
+		limits.MaxSaltLen = DefaultLimits.MaxSaltLen
+	}
+	return limits
+}
+
+// applyDefaults fills the empty or invalid fields of config with the package defaults.
+func applyDefaults(config Config) Config {
+	if config.Rounds <= 0 {
+		config.Rounds = ROUNDS
+	}
+	if config.KeyLen <= 0 {
+		config.KeyLen = KEY_LENGTH
+	}
+	if config.HashFunc < 0 || config.HashFunc > 5 {
+		config.HashFunc = DEFAULT_HASHFUNCTION
+	}
+	if config.SaltLen <= 0 {
+		config.SaltLen = SALT_LENGTH
+	}
+	if config.Rand == nil {
+		config.Rand = rand.Reader
+	}
+	return config
+}
+
+// Hash creates a PHC-formatted hash with the config. See the package-level Hash function.
+func (c Config) Hash(plain string) (string, error) {
+	return Hash(plain, c)
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided,
+// rejecting hashes whose parameters exceed c.Limits. See the package-level Verify function.
+func (c Config) Verify(hash, plain string) (bool, error) {
+	if hash == "" || plain == "" {
+		return false, ErrEmptyField
+	}
+
+	deserialize, _, err := parseHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	if len(deserialize.Hash) == 0 {
+		return false, format.ErrMissingHash
+	}
 	keyLen := int(len(deserialize.Hash))
 
-	rounds, err := strconv.ParseInt(deserialize.Params["i"].(string), 10, 32)
+	rounds, err := parseParams(deserialize)
 	if err != nil {
 		return false, err
 	}
 
+	if err := checkLimits(c.Limits, rounds, len(deserialize.Salt), len(deserialize.Hash)); err != nil {
+		return false, err
+	}
+
 	hashFunc := strings.Replace(deserialize.ID, "pbkdf2", "", 1)
 
 	var verifyHash []byte
@@ -198,3 +465,22 @@ func Verify(hash string, plain string) (bool, error) {
 	}
 	return false, nil
 }
+
+// NeedsRehash checks whether the hash is weaker than the config. See the package-level NeedsRehash function.
+func (c Config) NeedsRehash(hash string) (bool, error) {
+	return NeedsRehash(hash, c)
+}
+
+// UseConfig makes Config a config of phccrypto.Use, which names every parameter the way
+// the algorithm does. It can only be called by the packages of this module.
+func (c Config) UseConfig(sealed.Token) {}
+
+// IDs returns the PHC identifiers of the hashes that this package can verify,
+// including the identifiers of passlib.
+func (c Config) IDs() []string {
+	ids := make([]string, 0, int(MD5)+1+len(passlibHashFuncs))
+	for h := SHA1; h <= MD5; h++ {
+		ids = append(ids, "pbkdf2"+hashFuncToName(h))
+	}
+	return append(ids, "pbkdf2", "pbkdf2-sha256", "pbkdf2-sha512")
+}
@@ -1,9 +1,13 @@
 package pbkdf2_test
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aldy505/phc-crypto/format"
 	"github.com/aldy505/phc-crypto/pbkdf2"
 )
 
@@ -220,3 +224,311 @@ func TestError(t *testing.T) {
 		}
 	})
 }
+
+func TestNeedsRehash(t *testing.T) {
+	config := pbkdf2.Config{
+		Rounds:   1000,
+		KeyLen:   32,
+		HashFunc: pbkdf2.SHA256,
+		SaltLen:  16,
+	}
+
+	hash, err := pbkdf2.Hash("password123", config)
+	if err != nil {
+		t.Error(err)
+	}
+
+	t.Run("should return false on the same config", func(t *testing.T) {
+		rehash, err := pbkdf2.NeedsRehash(hash, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+	})
+
+	t.Run("should return true on stronger config", func(t *testing.T) {
+		stronger := []pbkdf2.Config{
+			{Rounds: 2000, KeyLen: 32, HashFunc: pbkdf2.SHA256, SaltLen: 16},
+			{Rounds: 1000, KeyLen: 64, HashFunc: pbkdf2.SHA256, SaltLen: 16},
+			{Rounds: 1000, KeyLen: 32, HashFunc: pbkdf2.SHA256, SaltLen: 32},
+			{Rounds: 1000, KeyLen: 32, HashFunc: pbkdf2.SHA512, SaltLen: 16},
+		}
+		for _, c := range stronger {
+			rehash, err := pbkdf2.NeedsRehash(hash, c)
+			if err != nil {
+				t.Error(err)
+			}
+			if !rehash {
+				t.Error("needs rehash function returned false for", c)
+			}
+		}
+	})
+
+	t.Run("should return error", func(t *testing.T) {
+		_, err := pbkdf2.NeedsRehash("$pkt$v=0$i=32$invalidSalt$invalidHash", config)
+		if err == nil || err.Error() != "hashed string is not pbkdf2 instance" {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	testCases := []struct {
+		name string
+		hash string
+		err  error
+	}{
+		{"missing param", "$pbkdf2sha256$v=0$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrMissingParam},
+		{"duplicate param", "$pbkdf2sha256$v=0$i=1,i=2$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrDuplicateParam},
+		{"unknown param", "$pbkdf2sha256$v=0$i=1,x=2$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrUnknownParam},
+		{"missing hash", "$pbkdf2sha256$v=0$i=1$c2FsdHNhbHQ", format.ErrMissingHash},
+		{"zero rounds", "$pbkdf2sha256$v=0$i=0$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrInvalidParam},
+		{"negative rounds", "$pbkdf2sha256$v=0$i=-1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrInvalidParam},
+		{"truncated", "$pbkdf2sha256$", format.ErrInvalidFormat},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := pbkdf2.Verify(tc.hash, "password123")
+			if !errors.Is(err, tc.err) {
+				t.Error("error should have been thrown:", err)
+			}
+		})
+	}
+}
+
+func FuzzVerify(f *testing.F) {
+	hash, err := pbkdf2.Hash("password123", pbkdf2.Config{Rounds: 10, KeyLen: 16, SaltLen: 8})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(hash, "password123")
+	f.Add("$pbkdf2sha256$v=0$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "password123")
+	f.Add("$pbkdf2md5$v=0$i=1$c2FsdHNhbHQ", "password123")
+	f.Add("$pbkdf2asdf$v=0$i=-1$$AA", "password123")
+	f.Add("$pbkdf2sha1$", "password123")
+	f.Add("$x$v=1$m$a$b", "password123")
+	f.Add("$pbkdf2-sha256$1000$991hB.BjWGYExPmpxKc7tA$Vteiqw", "password")
+
+	f.Fuzz(func(t *testing.T, hash string, plain string) {
+		_, _ = pbkdf2.Verify(hash, plain)
+		_, _ = pbkdf2.NeedsRehash(hash, pbkdf2.Config{})
+	})
+}
+
+func TestVerifyLimits(t *testing.T) {
+	t.Run("should reject hashes above the default limits", func(t *testing.T) {
+		_, err := pbkdf2.Verify("$pbkdf2sha256$v=0$i=2147483647$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "password123")
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+
+	t.Run("should enforce the limits of the config", func(t *testing.T) {
+		hash, err := pbkdf2.Hash("password123", pbkdf2.Config{Rounds: 100, KeyLen: 16, SaltLen: 8})
+		if err != nil {
+			t.Error(err)
+		}
+
+		testCases := []struct {
+			name   string
+			limits pbkdf2.Limits
+		}{
+			{"rounds", pbkdf2.Limits{MaxRounds: 99}},
+			{"key length", pbkdf2.Limits{MaxKeyLen: 8}},
+			{"salt length", pbkdf2.Limits{MaxSaltLen: 4}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := pbkdf2.Config{Limits: tc.limits}.Verify(hash, "password123")
+				if !errors.Is(err, format.ErrLimitExceeded) {
+					t.Error("error should have been thrown:", err)
+				}
+			})
+		}
+
+		verify, err := pbkdf2.Config{Limits: pbkdf2.Limits{MaxRounds: 100, MaxKeyLen: 16, MaxSaltLen: 8}}.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+}
+
+func TestPasslib(t *testing.T) {
+	t.Run("should verify passlib hashes", func(t *testing.T) {
+		testCases := []struct {
+			name string
+			hash string
+		}{
+			{"sha1", "$pbkdf2$1000$oG79ty8Gt7XmVzjlB.pKVA$Y4.urQY9GAtLh0/adMDe.ZAjmaE"},
+			{"sha256", "$pbkdf2-sha256$1000$991hB.BjWGYExPmpxKc7tA$Vteiq/daQVVkq27auqk/dQ9mM3rJeo4ttic2.Ye1z5M"},
+			{"sha256 documentation", "$pbkdf2-sha256$6400$.6UI/S.nXIk8jcbdHx3Fhg$98jZicV16ODfEsEZeYPGHU3kbrUrvUEXOPimVSQDD44"},
+			{"sha512", "$pbkdf2-sha512$1000$.zZjSlpvVOEz.2c.2DSDpA$6AapLJOfE/yAYT/L6L/4PzUUl6lFLQoGsnOjPWZr.AqcgJZcSnUyvcb/LnmpWwziBCXBUp3CrKP3NELt9J83Cw"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				verify, err := pbkdf2.Verify(tc.hash, "password")
+				if err != nil {
+					t.Error(err)
+				}
+				if !verify {
+					t.Error("verify function returned false")
+				}
+
+				verify, err = pbkdf2.Verify(tc.hash, "password123")
+				if err != nil {
+					t.Error(err)
+				}
+				if verify {
+					t.Error("verify function returned true")
+				}
+			})
+		}
+	})
+
+	t.Run("should emit passlib hashes", func(t *testing.T) {
+		config := pbkdf2.Config{HashFunc: pbkdf2.SHA512, Rounds: 1000, KeyLen: 64, Dialect: pbkdf2.Passlib}
+		hash, err := pbkdf2.Hash("password123", config)
+		if err != nil {
+			t.Error(err)
+		}
+		segments := strings.Split(hash, "$")
+		if len(segments) != 5 || segments[1] != "pbkdf2-sha512" || segments[2] != "1000" || strings.ContainsAny(hash, "+=") {
+			t.Error("unexpected encoding:", hash)
+		}
+
+		verify, err := pbkdf2.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+
+		rehash, err := pbkdf2.NeedsRehash(hash, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+
+		config.Dialect = pbkdf2.PHC
+		rehash, err = pbkdf2.NeedsRehash(hash, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should return error", func(t *testing.T) {
+		_, err := pbkdf2.Hash("password123", pbkdf2.Config{HashFunc: pbkdf2.MD5, Dialect: pbkdf2.Passlib})
+		if !errors.Is(err, pbkdf2.ErrInvalidHashFunction) {
+			t.Error("error should have been thrown:", err)
+		}
+
+		_, err = pbkdf2.Hash("password123", pbkdf2.Config{Dialect: 2})
+		if !errors.Is(err, pbkdf2.ErrInvalidDialect) {
+			t.Error("error should have been thrown:", err)
+		}
+
+		testCases := []struct {
+			name string
+			hash string
+			err  error
+		}{
+			{"missing hash", "$pbkdf2-sha256$1000$991hB.BjWGYExPmpxKc7tA", format.ErrMissingHash},
+			{"trailing data", "$pbkdf2-sha256$1000$991hB.BjWGYExPmpxKc7tA$Vteiq$x", format.ErrTrailingData},
+			{"rounds", "$pbkdf2-sha256$-1000$991hB.BjWGYExPmpxKc7tA$Vteiqw", format.ErrInvalidParam},
+			{"zero rounds", "$pbkdf2-sha256$0$991hB.BjWGYExPmpxKc7tA$Vteiqw", format.ErrInvalidParam},
+			{"alphabet", "$pbkdf2-sha256$1000$991hB+BjWGYExPmpxKc7tA$Vteiqw", format.ErrInvalidBase64},
+			{"limits", "$pbkdf2-sha256$2147483647$991hB.BjWGYExPmpxKc7tA$Vteiqw", format.ErrLimitExceeded},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := pbkdf2.Verify(tc.hash, "password")
+				if !errors.Is(err, tc.err) {
+					t.Error("error should have been thrown:", err)
+				}
+			})
+		}
+	})
+}
+
+func TestCalibrate(t *testing.T) {
+	t.Run("should stay within the limits", func(t *testing.T) {
+		config, err := pbkdf2.Calibrate(pbkdf2.SHA256, 20*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.HashFunc != pbkdf2.SHA256 || config.Rounds < 1000 || config.Rounds > pbkdf2.DefaultLimits.MaxRounds {
+			t.Errorf("unexpected config: %+v", config)
+		}
+	})
+
+	t.Run("should not go below the minimum", func(t *testing.T) {
+		config, err := pbkdf2.Calibrate(pbkdf2.SHA512, time.Nanosecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Rounds != 1000 {
+			t.Errorf("unexpected config: %+v", config)
+		}
+	})
+
+	t.Run("should return error on invalid target", func(t *testing.T) {
+		if _, err := pbkdf2.Calibrate(pbkdf2.SHA256, 0); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("expected ErrInvalidParam, got:", err)
+		}
+	})
+}
+
+func TestPresets(t *testing.T) {
+	presets := []struct {
+		name   string
+		config pbkdf2.Config
+	}{
+		{"OWASPSHA256", pbkdf2.OWASPSHA256},
+		{"OWASPSHA512", pbkdf2.OWASPSHA512},
+	}
+
+	for _, preset := range presets {
+		t.Run(preset.name+" should be accepted by Verify", func(t *testing.T) {
+			hash, err := pbkdf2.Hash("password123", preset.config)
+			if err != nil {
+				t.Error(err)
+			}
+			verify, err := pbkdf2.Verify(hash, "password123")
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false")
+			}
+		})
+	}
+
+	t.Run("should rehash the hashes of the defaults", func(t *testing.T) {
+		hash, err := pbkdf2.Hash("password123", pbkdf2.Config{HashFunc: pbkdf2.SHA256})
+		if err != nil {
+			t.Error(err)
+		}
+		rehash, err := pbkdf2.NeedsRehash(hash, pbkdf2.OWASPSHA256)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+}
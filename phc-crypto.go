@@ -2,11 +2,11 @@ package phccrypto
 
 import (
 	"errors"
+	"strconv"
 
 	"github.com/aldy505/phc-crypto/argon2"
-	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/aldy505/phc-crypto/format"
 	"github.com/aldy505/phc-crypto/pbkdf2"
-	"github.com/aldy505/phc-crypto/scrypt"
 )
 
 type Algorithm int
@@ -18,10 +18,30 @@ const (
 	PBKDF2
 )
 
+// String returns the name of the algorithm, the same as the name of its package.
+func (a Algorithm) String() string {
+	switch a {
+	case Scrypt:
+		return "scrypt"
+	case Bcrypt:
+		return "bcrypt"
+	case Argon2:
+		return "argon2"
+	case PBKDF2:
+		return "pbkdf2"
+	default:
+		return "Algorithm(" + strconv.Itoa(int(a)) + ")"
+	}
+}
+
 // Algo returns struct that will be use on Hash and Verify function
 type Algo struct {
-	Name   Algorithm
+	Name Algorithm
+	// Config is the general config given to Use. It's nil when Use was given
+	// the Config of an algorithm package.
 	Config *Config
+	// native is the Config of an algorithm package given to Use.
+	native Hasher
 }
 
 // Config returns the general config of the hashing function
@@ -37,38 +57,51 @@ type Config struct {
 
 var ErrAlgoNotSupported error = errors.New("the algorithm provided is not supported")
 var ErrEmptyField error = errors.New("function parameters must not be empty")
+var ErrInvalidConfig error = errors.New("invalid config")
 
-// Use initiates the hash/verify function.
-// Available hash functions are: bcrypt, scrypt, argon2, pbkdf2.
-// Please refer to each hash folder for configuration information.
+// ErrLimitExceeded is returned by Verify when the parameters of a hash exceed the limits
+// of the Hasher that verifies it. It's the same error as format.ErrLimitExceeded.
+var ErrLimitExceeded error = format.ErrLimitExceeded
+
+// Use initiates the hash/verify function with the algorithm (Scrypt, Bcrypt, Argon2 or PBKDF2)
+// and its config. Please refer to each hash folder for configuration information.
+//
+// The config is either the general Config, or the Config of the package of the algorithm
+// (argon2.Config, bcrypt.Config, pbkdf2.Config or scrypt.Config), which names every parameter
+// the way the algorithm does and gives access to all of them.
 //
-//      import (
-//      	"fmt"
-//      	"github.com/aldy505/phc-crypto"
-//      )
+// The config is validated against the legal ranges of the algorithm up front, and
+// an error wrapping ErrInvalidConfig describes the first field that is out of range,
+// including the fields of the general Config that the algorithm doesn't use, and the Config
+// of another algorithm package. Empty fields fall back to the defaults of the algorithm.
+// An unknown algorithm returns ErrAlgoNotSupported.
 //
-//      func main() {
-//      	// Create a crypto instance
-//      	// Change the scope name to your prefered hashing algorithm
-//      	// Available options are: Bcrypt, Scrypt, Argon2, PBKDF2
-//      	crypto, err := phccrypto.Use(phccrypto.Scrypt, phccrypto.Config{})
+//	crypto, err := phccrypto.Use(phccrypto.Argon2, argon2.Config{Time: 3, Memory: 64 * 1024})
+//	if err != nil {
+//		fmt.Println(err)
+//	}
 //
-//        hash, err := crypto.Hash("password123")
-//        if err != nil {
-//        	fmt.Println(err)
-//        }
-//        fmt.Println(hash) // returns string ($scrypt$v=0$p=1,ln=32768,r=8$402ffb0b23cd3d3a$62daeae2ac...)
+//	hash, err := crypto.Hash("password123")
+//	if err != nil {
+//		fmt.Println(err)
+//	}
+//	fmt.Println(hash) // returns string ($argon2id$v=19$m=65536,t=3,p=4$...)
 //
-//      	verify, err := crypto.Verify(hash, "password123")
-//      	if err != nil {
-//      		fmt.Println(err)
-//      	}
-//      	fmt.Println(verify) // returns boolean (true/false)
-//      }
-func Use(name Algorithm, config Config) (*Algo, error) {
-	algo := &Algo{
-		Name:   name,
-		Config: &config,
+//	verify, err := crypto.Verify(hash, "password123")
+//	if err != nil {
+//		fmt.Println(err)
+//	}
+//	fmt.Println(verify) // returns boolean (true/false)
+func Use(name Algorithm, config AlgoConfig) (*Algo, error) {
+	if err := validate(name, config); err != nil {
+		return nil, err
+	}
+
+	algo := &Algo{Name: name}
+	if general, ok := config.(Config); ok {
+		algo.Config = &general
+	} else {
+		algo.native = config.(Hasher)
 	}
 	return algo, nil
 }
@@ -81,41 +114,14 @@ func (a *Algo) Hash(plain string) (hash string, err error) {
 		return
 	}
 
-	switch a.Name {
-	case Scrypt:
-		hash, err = scrypt.Hash(plain, scrypt.Config{
-			Cost:        a.Config.Cost,
-			Rounds:      a.Config.Rounds,
-			Parallelism: a.Config.Parallelism,
-			KeyLen:      a.Config.KeyLen,
-		})
-		return
-	case Bcrypt:
-		hash, err = bcrypt.Hash(plain, bcrypt.Config{
-			Rounds: a.Config.Rounds,
-		})
-		return
-	case Argon2:
-		hash, err = argon2.Hash(plain, argon2.Config{
-			Time:        a.Config.Rounds,
-			Memory:      a.Config.Cost,
-			Parallelism: a.Config.Parallelism,
-			KeyLen:      a.Config.KeyLen,
-			Variant:     a.Config.Variant,
-		})
-		return
-	case PBKDF2:
-		hash, err = pbkdf2.Hash(plain, pbkdf2.Config{
-			Rounds:   a.Config.Rounds,
-			KeyLen:   a.Config.KeyLen,
-			HashFunc: a.Config.HashFunc,
-		})
-		return
-	default:
+	hasher, err := a.hasher()
+	if err != nil {
 		hash = ""
-		err = ErrAlgoNotSupported
 		return
 	}
+
+	hash, err = hasher.Hash(plain)
+	return
 }
 
 // Verify returns a boolean of a hash function (that was initiated from Use).
@@ -126,22 +132,130 @@ func (a *Algo) Verify(hash, plain string) (verify bool, err error) {
 		return
 	}
 
-	switch a.Name {
-	case Scrypt:
-		verify, err = scrypt.Verify(hash, plain)
-		return
-	case Bcrypt:
-		verify, err = bcrypt.Verify(hash, plain)
-		return
-	case Argon2:
-		verify, err = argon2.Verify(hash, plain)
+	hasher, err := a.hasher()
+	if err != nil {
+		verify = false
 		return
-	case PBKDF2:
-		verify, err = pbkdf2.Verify(hash, plain)
+	}
+
+	verify, err = hasher.Verify(hash, plain)
+	return
+}
+
+// Verify returns a boolean of a hash function, regardless of which algorithm was used to create it.
+// The algorithm is detected from the PHC identifier of the hash and the hash is verified by
+// the Hasher registered for that identifier (see Register), so hashes created by different
+// algorithms can be verified through the same call.
+//
+//	verify, err := phccrypto.Verify("$argon2id$v=19$m=65536,t=16,p=4$...", "password123")
+//	if err != nil {
+//		fmt.Println(err)
+//	}
+//	fmt.Println(verify) // returns boolean (true/false)
+func Verify(hash, plain string) (verify bool, err error) {
+	if hash == "" || plain == "" {
+		verify = false
+		err = ErrEmptyField
 		return
-	default:
+	}
+
+	hasher, ok := lookup(hash)
+	if !ok {
 		verify = false
 		err = ErrAlgoNotSupported
 		return
 	}
+
+	verify, err = hasher.Verify(hash, plain)
+	return
+}
+
+// NeedsRehash checks whether the hash should be recomputed with the algorithm and config
+// (that was initiated from Use). That is the case when the hash was created by another algorithm,
+// or when its parameters, salt or key length are weaker than the config.
+//
+//	crypto, err := phccrypto.Use(phccrypto.Argon2, phccrypto.Config{})
+//
+//	rehash, err := crypto.NeedsRehash("$pbkdf2sha256$v=0$i=4096$...")
+//	if err != nil {
+//		fmt.Println(err)
+//	}
+//	fmt.Println(rehash) // true
+func (a *Algo) NeedsRehash(hash string) (rehash bool, err error) {
+	if hash == "" {
+		rehash = false
+		err = ErrEmptyField
+		return
+	}
+
+	hasher, err := a.hasher()
+	if err != nil {
+		rehash = false
+		return
+	}
+
+	if !hasIdentifier(hasher, hash) {
+		rehash = true
+		return
+	}
+
+	rehash, err = hasher.NeedsRehash(hash)
+	return
+}
+
+// VerifyAndUpgrade verifies the hash with the algorithm and config (that was initiated from Use)
+// when the hash is one of its identifiers, so that its key provider and limits apply, and the same way
+// Verify (the package-level function) does otherwise. When the plain text matches a hash that needs
+// rehash (see NeedsRehash), it also returns a new hash created with the algorithm and config.
+// The returned hash is empty when the stored hash does not need to be replaced.
+//
+//	crypto, err := phccrypto.Use(phccrypto.Argon2, phccrypto.Config{})
+//
+//	verify, upgraded, err := crypto.VerifyAndUpgrade("$pbkdf2md5$v=0$i=4096$...", "password123")
+//	if err != nil {
+//		fmt.Println(err)
+//	}
+//	fmt.Println(verify) // returns boolean (true/false)
+//	if upgraded != "" {
+//		// store the upgraded hash in place of the old one
+//	}
+func (a *Algo) VerifyAndUpgrade(hash, plain string) (verify bool, upgraded string, err error) {
+	if hash == "" || plain == "" {
+		err = ErrEmptyField
+		return
+	}
+
+	hasher, err := a.hasher()
+	if err != nil {
+		return
+	}
+
+	if hasIdentifier(hasher, hash) {
+		verify, err = hasher.Verify(hash, plain)
+	} else {
+		verify, err = Verify(hash, plain)
+	}
+	if err != nil || !verify {
+		return
+	}
+
+	rehash, err := a.NeedsRehash(hash)
+	if err != nil || !rehash {
+		return
+	}
+
+	upgraded, err = a.Hash(plain)
+	return
+}
+
+// hasher returns the Hasher of the algorithm, configured with the config given to Use.
+// A nil Algo, as returned by Use on error, has no Hasher.
+func (a *Algo) hasher() (Hasher, error) {
+	if a != nil && a.native != nil {
+		return a.native, nil
+	}
+	if a == nil || a.Config == nil {
+		return nil, ErrAlgoNotSupported
+	}
+	return a.Config.native(a.Name)
 }
@@ -1,9 +1,17 @@
 package phccrypto_test
 
 import (
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	phccrypto "github.com/aldy505/phc-crypto"
+	"github.com/aldy505/phc-crypto/argon2"
+	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/pbkdf2"
+	"github.com/aldy505/phc-crypto/scrypt"
 )
 
 func TestUse(t *testing.T) {
@@ -30,6 +38,199 @@ func TestUse(t *testing.T) {
 			t.Error("something is wrong:", crypto.Name, "with 4")
 		}
 	})
+
+	t.Run("should return error on unknown algorithm up front", func(t *testing.T) {
+		crypto, err := phccrypto.Use(4, phccrypto.Config{})
+		if !errors.Is(err, phccrypto.ErrAlgoNotSupported) {
+			t.Error("expected ErrAlgoNotSupported, got:", err)
+		}
+		if crypto != nil {
+			t.Error("crypto should be nil")
+		}
+	})
+
+	t.Run("should validate the config", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			algo   phccrypto.Algorithm
+			config phccrypto.Config
+		}{
+			{"negative field", phccrypto.Argon2, phccrypto.Config{KeyLen: -1}},
+			{"bcrypt rounds", phccrypto.Bcrypt, phccrypto.Config{Rounds: 50}},
+			{"bcrypt rounds too low", phccrypto.Bcrypt, phccrypto.Config{Rounds: 3}},
+			{"bcrypt salt length", phccrypto.Bcrypt, phccrypto.Config{SaltLen: 32}},
+			{"bcrypt unused field", phccrypto.Bcrypt, phccrypto.Config{Parallelism: 2}},
+			{"scrypt cost not a power of 2", phccrypto.Scrypt, phccrypto.Config{Cost: 1000}},
+			{"scrypt cost above the limits", phccrypto.Scrypt, phccrypto.Config{Cost: 1 << 24}},
+			{"scrypt memory above the limits", phccrypto.Scrypt, phccrypto.Config{Cost: 1 << 20, Rounds: 16}},
+			{"argon2 parallelism", phccrypto.Argon2, phccrypto.Config{Parallelism: 256}},
+			{"argon2 memory below the lanes", phccrypto.Argon2, phccrypto.Config{Cost: 16, Parallelism: 4}},
+			{"argon2 variant", phccrypto.Argon2, phccrypto.Config{Variant: 7}},
+			{"argon2 key length", phccrypto.Argon2, phccrypto.Config{KeyLen: 2}},
+			{"pbkdf2 hash function", phccrypto.PBKDF2, phccrypto.Config{HashFunc: 9}},
+			{"pbkdf2 unused field", phccrypto.PBKDF2, phccrypto.Config{Cost: 1024}},
+			{"variant of another algorithm", phccrypto.Scrypt, phccrypto.Config{Variant: argon2.I}},
+			{"hash function of another algorithm", phccrypto.Argon2, phccrypto.Config{HashFunc: pbkdf2.SHA512}},
+			{"salt too short", phccrypto.Scrypt, phccrypto.Config{SaltLen: 4}},
+			{"salt too long", phccrypto.PBKDF2, phccrypto.Config{SaltLen: 2048}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				crypto, err := phccrypto.Use(tc.algo, tc.config)
+				if !errors.Is(err, phccrypto.ErrInvalidConfig) {
+					t.Error("expected ErrInvalidConfig, got:", err)
+				}
+				if crypto != nil {
+					t.Error("crypto should be nil")
+				}
+			})
+		}
+	})
+
+	t.Run("should accept every bcrypt cost", func(t *testing.T) {
+		for _, rounds := range []int{4, 17, 20, 31} {
+			if _, err := phccrypto.Use(phccrypto.Bcrypt, phccrypto.Config{Rounds: rounds}); err != nil {
+				t.Errorf("rounds %d: unexpected error: %v", rounds, err)
+			}
+		}
+	})
+
+	t.Run("should forward the salt length", func(t *testing.T) {
+		for _, name := range []phccrypto.Algorithm{phccrypto.Scrypt, phccrypto.Argon2, phccrypto.PBKDF2} {
+			crypto, err := phccrypto.Use(name, phccrypto.Config{SaltLen: 8})
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash, err := crypto.Hash("password123")
+			if err != nil {
+				t.Error(err)
+			}
+
+			deserialize, err := format.Deserialize(hash)
+			if err != nil {
+				t.Error(err)
+			}
+			if len(deserialize.Salt) != 8 {
+				t.Errorf("expected a salt of 8 bytes, got %d in %s", len(deserialize.Salt), hash)
+			}
+		}
+	})
+}
+
+func TestUseNativeConfig(t *testing.T) {
+	t.Run("should hash with the config of the algorithm package", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			algo   phccrypto.Algorithm
+			config phccrypto.AlgoConfig
+			prefix string
+		}{
+			{"argon2", phccrypto.Argon2, argon2.Config{Time: 1, Memory: 1024, Parallelism: 1}, "$argon2id$v=19$m=1024,t=1,p=1$"},
+			{"bcrypt", phccrypto.Bcrypt, bcrypt.Config{Rounds: 4, SHA256: true}, "$bcrypt-sha256$v=2,t=2b,r=4$"},
+			{"pbkdf2", phccrypto.PBKDF2, pbkdf2.Config{Rounds: 1000, HashFunc: pbkdf2.SHA512}, "$pbkdf2sha512$"},
+			{"scrypt", phccrypto.Scrypt, scrypt.Config{Cost: 1024, Rounds: 8}, "$scrypt$ln=10,r=8,p=1$"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				crypto, err := phccrypto.Use(tc.algo, tc.config)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if crypto.Config != nil {
+					t.Error("general config should be nil")
+				}
+
+				hash, err := crypto.Hash("password123")
+				if err != nil {
+					t.Error(err)
+				}
+				if !strings.HasPrefix(hash, tc.prefix) {
+					t.Error("unexpected encoding:", hash)
+				}
+
+				verify, err := crypto.Verify(hash, "password123")
+				if err != nil {
+					t.Error(err)
+				}
+				if !verify {
+					t.Error("verify function returned false")
+				}
+
+				rehash, err := crypto.NeedsRehash(hash)
+				if err != nil {
+					t.Error(err)
+				}
+				if rehash {
+					t.Error("needs rehash function returned true")
+				}
+			})
+		}
+	})
+
+	t.Run("should apply the limits of the config", func(t *testing.T) {
+		crypto, err := phccrypto.Use(phccrypto.Argon2, argon2.Config{Limits: argon2.Limits{MaxMemory: 512}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = crypto.Verify("$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "password123")
+		if !errors.Is(err, phccrypto.ErrLimitExceeded) {
+			t.Error("expected ErrLimitExceeded, got:", err)
+		}
+	})
+
+	t.Run("should name the algorithm on a config of another algorithm", func(t *testing.T) {
+		_, err := phccrypto.Use(phccrypto.Argon2, scrypt.Config{})
+		if err == nil || err.Error() != "invalid config: scrypt.Config can't be used for algorithm argon2" {
+			t.Error("unexpected error:", err)
+		}
+	})
+
+	t.Run("should validate the config", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			algo   phccrypto.Algorithm
+			config phccrypto.AlgoConfig
+		}{
+			{"nil", phccrypto.Argon2, nil},
+			{"config of another algorithm", phccrypto.Argon2, scrypt.Config{}},
+			{"argon2 parallelism", phccrypto.Argon2, argon2.Config{Parallelism: 300}},
+			{"argon2 key id", phccrypto.Argon2, argon2.Config{KeyProvider: argon2.KeyProviderFunc(func(string) ([]byte, error) { return nil, nil })}},
+			{"bcrypt rounds", phccrypto.Bcrypt, bcrypt.Config{Rounds: 50}},
+			{"bcrypt-sha256 variant", phccrypto.Bcrypt, bcrypt.Config{Variant: bcrypt.Y, SHA256: true}},
+			{"pbkdf2 dialect", phccrypto.PBKDF2, pbkdf2.Config{Dialect: 5}},
+			{"scrypt cost", phccrypto.Scrypt, scrypt.Config{Cost: 1000}},
+			{"scrypt salt length", phccrypto.Scrypt, scrypt.Config{SaltLen: 4}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				crypto, err := phccrypto.Use(tc.algo, tc.config)
+				if !errors.Is(err, phccrypto.ErrInvalidConfig) {
+					t.Error("expected ErrInvalidConfig, got:", err)
+				}
+				if crypto != nil {
+					t.Error("crypto should be nil")
+				}
+			})
+		}
+	})
+}
+
+func TestAlgorithmString(t *testing.T) {
+	names := map[phccrypto.Algorithm]string{
+		phccrypto.Scrypt: "scrypt",
+		phccrypto.Bcrypt: "bcrypt",
+		phccrypto.Argon2: "argon2",
+		phccrypto.PBKDF2: "pbkdf2",
+		7:                "Algorithm(7)",
+	}
+	for algo, name := range names {
+		if algo.String() != name {
+			t.Errorf("unexpected name: got %q, want %q", algo.String(), name)
+		}
+	}
 }
 
 func TestAlgoNotSupported(t *testing.T) {
@@ -159,3 +360,519 @@ func TestError(t *testing.T) {
 		}
 	})
 }
+
+func TestVerify(t *testing.T) {
+	t.Run("should detect the algorithm from the hash", func(t *testing.T) {
+		names := []phccrypto.Algorithm{phccrypto.Scrypt, phccrypto.Argon2, phccrypto.Bcrypt, phccrypto.PBKDF2}
+
+		for i := range names {
+			crypto, err := phccrypto.Use(names[i], phccrypto.Config{})
+			if err != nil {
+				t.Error(err)
+			}
+
+			hash, err := crypto.Hash("password123")
+			if err != nil {
+				t.Error(err)
+			}
+
+			verify, err := phccrypto.Verify(hash, "password123")
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false for", hash)
+			}
+
+			verify, err = phccrypto.Verify(hash, "password321")
+			if err != nil {
+				t.Error(err)
+			}
+			if verify {
+				t.Error("verify function returned true for", hash)
+			}
+		}
+	})
+
+	t.Run("should verify bcrypt hashes in modular crypt format", func(t *testing.T) {
+		verify, err := phccrypto.Verify("$2y$05$N9qo8uLOickgx2ZMRZoMyeM5QvkGKkl3PupXuSSuV94PwE.Qp7N8a", "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should verify passlib pbkdf2 hashes", func(t *testing.T) {
+		verify, err := phccrypto.Verify("$pbkdf2-sha256$6400$.6UI/S.nXIk8jcbdHx3Fhg$98jZicV16ODfEsEZeYPGHU3kbrUrvUEXOPimVSQDD44", "password")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should verify bcrypt-sha256 hashes", func(t *testing.T) {
+		verify, err := phccrypto.Verify("$bcrypt-sha256$v=2,t=2b,r=4$N9qo8uLOickgx2ZMRZoMye$AhvKDW9FTKd0WiUY9YKux/0/Y1UvVly", "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should verify sha-crypt hashes", func(t *testing.T) {
+		verify, err := phccrypto.Verify("$6$rounds=1000$N9qo8uLOickgx2ZM$LakrvQiz.vRTLyTgEIFc32aVUTL/GxtJg1R8br36KHd8PYPSZs.ZU45aSTOYSu025OWER0Bx2SrOBH6ZaquL3/", "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should verify yescrypt hashes", func(t *testing.T) {
+		verify, err := phccrypto.Verify("$y$j75$k2XAnEHBqQ1Ct2aMXFKNa/$o4n6DxQO2TnJxXZ7vt8M1m2mhsPufv4SGsW0LPXEYQD", "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should return error on unknown identifier", func(t *testing.T) {
+		_, err := phccrypto.Verify("$md5$v=0$r=1$U2FsdHlUZXh0$SGFzaHlUZXh0", "something")
+		if err == nil || err.Error() != "the algorithm provided is not supported" {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+
+	t.Run("should return error on invalid format", func(t *testing.T) {
+		_, err := phccrypto.Verify("something else", "something")
+		if err == nil {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+
+	t.Run("should reject hashes above the limits", func(t *testing.T) {
+		_, err := phccrypto.Verify("$argon2id$v=19$m=4294967295,t=1,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "something")
+		if !errors.Is(err, phccrypto.ErrLimitExceeded) {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+
+	t.Run("should complain on empty function parameters", func(t *testing.T) {
+		_, err := phccrypto.Verify("", "")
+		if err == nil || err.Error() != "function parameters must not be empty" {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func TestNeedsRehash(t *testing.T) {
+	crypto, err := phccrypto.Use(phccrypto.PBKDF2, phccrypto.Config{
+		Rounds:   1000,
+		HashFunc: pbkdf2.SHA256,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	hash, err := crypto.Hash("password123")
+	if err != nil {
+		t.Error(err)
+	}
+
+	t.Run("should return false on the same config", func(t *testing.T) {
+		rehash, err := crypto.NeedsRehash(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+	})
+
+	t.Run("should return true on stronger config", func(t *testing.T) {
+		stronger, _ := phccrypto.Use(phccrypto.PBKDF2, phccrypto.Config{
+			Rounds:   2000,
+			HashFunc: pbkdf2.SHA256,
+		})
+		rehash, err := stronger.NeedsRehash(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should return true on different algorithm", func(t *testing.T) {
+		other, _ := phccrypto.Use(phccrypto.Argon2, phccrypto.Config{})
+		rehash, err := other.NeedsRehash(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should complain on empty function parameters", func(t *testing.T) {
+		_, err := crypto.NeedsRehash("")
+		if err == nil || err.Error() != "function parameters must not be empty" {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func TestVerifyAndUpgrade(t *testing.T) {
+	crypto, err := phccrypto.Use(phccrypto.PBKDF2, phccrypto.Config{
+		Rounds:   1000,
+		HashFunc: pbkdf2.SHA256,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	t.Run("should upgrade hash from another algorithm", func(t *testing.T) {
+		hash, err := pbkdf2.Hash("password123", pbkdf2.Config{HashFunc: pbkdf2.MD5})
+		if err != nil {
+			t.Error(err)
+		}
+
+		verify, upgraded, err := crypto.VerifyAndUpgrade(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+		if upgraded == "" || upgraded == hash {
+			t.Error("hash was not upgraded:", upgraded)
+		}
+
+		rehash, err := crypto.NeedsRehash(upgraded)
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("upgraded hash still needs rehash")
+		}
+
+		verify, err = phccrypto.Verify(upgraded, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("upgraded hash does not verify")
+		}
+	})
+
+	t.Run("should upgrade legacy hashes", func(t *testing.T) {
+		hashes := []string{
+			"$1$N9qo8uLO$FJZzzotYdygzbuLycG/nL.",
+			"$apr1$N9qo8uLO$zRdsB6I/FWxXk/nVwrfRb.",
+			"{SSHA}NfXGOurglbemZP/7+M3tqa+/Zn6KHwPCTjlxbw==",
+			"{ssha512}Z87pLDarOj88eNpR1qPURHDT2I563T1zMtQ08mpWnO9LKvzju1/HzBn9YoqykftgtsaM+WsiKtH0ytANHh0S/IofA8JOOXFv",
+			"{SMD5}txeSHKBuqCggDj+x4KnMzoofA8JOOXFv",
+		}
+
+		for _, hash := range hashes {
+			verify, upgraded, err := crypto.VerifyAndUpgrade(hash, "password123")
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false for", hash)
+			}
+			if !strings.HasPrefix(upgraded, "$pbkdf2sha256$") {
+				t.Error("hash was not upgraded:", hash)
+			}
+		}
+	})
+
+	t.Run("should not upgrade up-to-date hash", func(t *testing.T) {
+		hash, err := crypto.Hash("password123")
+		if err != nil {
+			t.Error(err)
+		}
+
+		verify, upgraded, err := crypto.VerifyAndUpgrade(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+		if upgraded != "" {
+			t.Error("hash should not have been upgraded:", upgraded)
+		}
+	})
+
+	t.Run("should verify with the key provider of the config", func(t *testing.T) {
+		provider := argon2.KeyProviderFunc(func(id string) ([]byte, error) {
+			return []byte("pepper of " + id), nil
+		})
+		crypto, err := phccrypto.Use(phccrypto.Argon2, argon2.Config{Time: 1, Memory: 64, Parallelism: 1, KeyProvider: provider, KeyID: "k1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := crypto.Hash("password123")
+		if err != nil {
+			t.Error(err)
+		}
+
+		verify, upgraded, err := crypto.VerifyAndUpgrade(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+		if upgraded != "" {
+			t.Error("hash should not have been upgraded:", upgraded)
+		}
+
+		verify, _, err = crypto.VerifyAndUpgrade(hash, "password321")
+		if err != nil {
+			t.Error(err)
+		}
+		if verify {
+			t.Error("verify function returned true")
+		}
+	})
+
+	t.Run("should verify with the limits of the config", func(t *testing.T) {
+		// the registered bcrypt hasher refuses the hashes of the config
+		phccrypto.Register(bcrypt.Config{Limits: bcrypt.Limits{MaxRounds: 4}})
+		defer phccrypto.Register(bcrypt.Config{})
+
+		crypto, err := phccrypto.Use(phccrypto.Bcrypt, bcrypt.Config{Rounds: 5, Limits: bcrypt.Limits{MaxRounds: 5}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := crypto.Hash("password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if _, err := phccrypto.Verify(hash, "password123"); !errors.Is(err, phccrypto.ErrLimitExceeded) {
+			t.Error("expected ErrLimitExceeded, got:", err)
+		}
+
+		verify, upgraded, err := crypto.VerifyAndUpgrade(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+		if upgraded != "" {
+			t.Error("hash should not have been upgraded:", upgraded)
+		}
+	})
+
+	t.Run("should not upgrade on wrong password", func(t *testing.T) {
+		hash, err := pbkdf2.Hash("password123", pbkdf2.Config{HashFunc: pbkdf2.MD5})
+		if err != nil {
+			t.Error(err)
+		}
+
+		verify, upgraded, err := crypto.VerifyAndUpgrade(hash, "password321")
+		if err != nil {
+			t.Error(err)
+		}
+		if verify {
+			t.Error("verify function returned true")
+		}
+		if upgraded != "" {
+			t.Error("hash should not have been upgraded:", upgraded)
+		}
+	})
+}
+
+func FuzzVerify(f *testing.F) {
+	f.Add("$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "password123")
+	f.Add("$scrypt$ln=4,r=1,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "password123")
+	f.Add("$pbkdf2sha256$v=0$i=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "password123")
+	f.Add("$bcrypt$v=0$r=4$$JDJhJDA0JA", "password123")
+	f.Add("$5$rounds=1000$saltstring$5B8vYYiY", "password123")
+	f.Add("$y$j75$k2XAnEHBqQ1Ct2aMXFKNa/$o4n6DxQO2TnJxXZ7vt8M1m2mhsPufv4SGsW0LPXEYQD", "password123")
+	f.Add("{SSHA}NfXGOurglbemZP/7+M3tqa+/Zn6KHwPCTjlxbw==", "password123")
+	f.Add("$argon2id$", "password123")
+	f.Add("$$", "password123")
+	f.Add("something", "password123")
+
+	f.Fuzz(func(t *testing.T, hash string, plain string) {
+		_, _ = phccrypto.Verify(hash, plain)
+	})
+}
+
+func TestCalibrate(t *testing.T) {
+	testCases := []struct {
+		name string
+		algo phccrypto.Algorithm
+	}{
+		{"scrypt", phccrypto.Scrypt},
+		{"bcrypt", phccrypto.Bcrypt},
+		{"argon2", phccrypto.Argon2},
+		{"pbkdf2", phccrypto.PBKDF2},
+	}
+
+	for _, tc := range testCases {
+		t.Run("should create configs for Use with "+tc.name, func(t *testing.T) {
+			config, err := phccrypto.Calibrate(tc.algo, 10*time.Millisecond, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			crypto, err := phccrypto.Use(tc.algo, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash, err := crypto.Hash("password123")
+			if err != nil {
+				t.Error(err)
+			}
+			verify, err := phccrypto.Verify(hash, "password123")
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false")
+			}
+		})
+	}
+
+	t.Run("should return error on unknown algorithm", func(t *testing.T) {
+		_, err := phccrypto.Calibrate(10, time.Second, 1<<20)
+		if !errors.Is(err, phccrypto.ErrAlgoNotSupported) {
+			t.Error("expected ErrAlgoNotSupported, got:", err)
+		}
+	})
+}
+
+func TestRecommended(t *testing.T) {
+	policy := phccrypto.Recommended()
+	if policy.Version < 1 {
+		t.Error("unexpected policy version:", policy.Version)
+	}
+
+	crypto, err := policy.Use()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should create hashes that don't need rehash", func(t *testing.T) {
+		hash, err := crypto.Hash("password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=4$") {
+			t.Error("unexpected encoding:", hash)
+		}
+
+		rehash, err := crypto.NeedsRehash(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+	})
+
+	t.Run("should rehash the hashes that predate the policy", func(t *testing.T) {
+		old, err := phccrypto.Use(phccrypto.Argon2, phccrypto.Config{Rounds: 1, Cost: 64 * 1024, Parallelism: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := old.Hash("password123")
+		if err != nil {
+			t.Error(err)
+		}
+
+		rehash, err := crypto.NeedsRehash(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+
+		rehash, err = policy.NeedsRehash(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function of the policy returned false")
+		}
+
+		version, err := phccrypto.HashVersion(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if version != 0 {
+			t.Error("unexpected hash version:", version)
+		}
+	})
+
+	t.Run("should tell the version of the hashes of the policy", func(t *testing.T) {
+		hash, err := crypto.Hash("password123")
+		if err != nil {
+			t.Error(err)
+		}
+
+		version, err := phccrypto.HashVersion(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if version != policy.Version {
+			t.Error("unexpected hash version:", version)
+		}
+
+		rehash, err := policy.NeedsRehash(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function of the policy returned true")
+		}
+	})
+
+	t.Run("should accept the hashes of a later policy", func(t *testing.T) {
+		hash, err := crypto.Hash("password123")
+		if err != nil {
+			t.Error(err)
+		}
+
+		older := phccrypto.Policy{Version: policy.Version - 1, Algorithm: phccrypto.Bcrypt, Config: phccrypto.Config{Rounds: 4}}
+		rehash, err := older.NeedsRehash(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function of the policy returned true")
+		}
+
+		// a hash of neither policy predates both
+		weak, err := phccrypto.Use(phccrypto.PBKDF2, phccrypto.Config{Rounds: 1000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err = weak.Hash("password123")
+		if err != nil {
+			t.Error(err)
+		}
+		rehash, err = older.NeedsRehash(hash)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function of the policy returned false")
+		}
+	})
+}
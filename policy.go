@@ -0,0 +1,112 @@
+package phccrypto
+
+import "github.com/aldy505/phc-crypto/argon2"
+
+// Policy is a versioned recommendation of the algorithm and the config to create hashes with.
+type Policy struct {
+	// Version is the number of the policy in the history of the recommended policies,
+	// raised whenever the recommendation changes. NeedsRehash accepts the hashes that
+	// meet a later version, and HashVersion tells which version a hash meets.
+	Version   int
+	Algorithm Algorithm
+	Config    Config
+}
+
+// policies is the history of the recommended policies, oldest first. A new recommendation
+// is appended with the next version, the previous ones are never changed. A new version
+// is never weaker than the previous ones, so the NeedsRehash of the Algo of the current
+// policy reports the hashes created with an older one.
+var policies = []Policy{
+	{
+		Version:   1,
+		Algorithm: Argon2,
+		Config: Config{
+			Cost:        argon2.RFC9106LowMemory.Memory,
+			Rounds:      argon2.RFC9106LowMemory.Time,
+			Parallelism: argon2.RFC9106LowMemory.Parallelism,
+			KeyLen:      argon2.RFC9106LowMemory.KeyLen,
+			SaltLen:     argon2.RFC9106LowMemory.SaltLen,
+			Variant:     argon2.RFC9106LowMemory.Variant,
+		},
+	},
+}
+
+// Recommended returns the current policy of the package: argon2id with the
+// low memory option of RFC 9106 (argon2.RFC9106LowMemory), at version 1.
+//
+//	crypto, err := phccrypto.Recommended().Use()
+//	if err != nil {
+//		fmt.Println(err)
+//	}
+//
+//	verify, upgraded, err := crypto.VerifyAndUpgrade(storedHash, "password123")
+//	if err != nil {
+//		fmt.Println(err)
+//	}
+//	if upgraded != "" {
+//		// the stored hash predates the policy, store the upgraded hash in place of it
+//	}
+func Recommended() Policy {
+	return policies[len(policies)-1]
+}
+
+// HashVersion returns the version of the latest recommended policy that the hash meets,
+// that is whose Algo doesn't report it with NeedsRehash, or 0 when the hash meets none of them.
+//
+//	version, err := phccrypto.HashVersion(storedHash)
+//	if err != nil {
+//		fmt.Println(err)
+//	}
+//	if version < phccrypto.Recommended().Version {
+//		// the stored hash predates the current policy
+//	}
+func HashVersion(hash string) (int, error) {
+	for i := len(policies) - 1; i >= 0; i-- {
+		meets, err := policies[i].meets(hash)
+		if err != nil {
+			return 0, err
+		}
+		if meets {
+			return policies[i].Version, nil
+		}
+	}
+	return 0, nil
+}
+
+// Use initiates the hash/verify function with the algorithm and the config of the policy.
+func (p Policy) Use() (*Algo, error) {
+	return Use(p.Algorithm, p.Config)
+}
+
+// NeedsRehash checks whether the hash predates the policy: it meets neither the policy
+// nor any of the recommended policies of a later version. Unlike the NeedsRehash of the Algo
+// of the policy, it accepts a hash created with a later policy, even of another algorithm.
+func (p Policy) NeedsRehash(hash string) (bool, error) {
+	meets, err := p.meets(hash)
+	if err != nil || meets {
+		return false, err
+	}
+	for _, policy := range policies {
+		if policy.Version <= p.Version {
+			continue
+		}
+		meets, err := policy.meets(hash)
+		if err != nil || meets {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// meets reports whether the hash is at least as strong as the config of the policy.
+func (p Policy) meets(hash string) (bool, error) {
+	crypto, err := p.Use()
+	if err != nil {
+		return false, err
+	}
+	rehash, err := crypto.NeedsRehash(hash)
+	if err != nil {
+		return false, err
+	}
+	return !rehash, nil
+}
@@ -0,0 +1,103 @@
+package phccrypto
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/aldy505/phc-crypto/argon2"
+	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/aldy505/phc-crypto/legacy"
+	"github.com/aldy505/phc-crypto/pbkdf2"
+	"github.com/aldy505/phc-crypto/scrypt"
+	"github.com/aldy505/phc-crypto/shacrypt"
+	"github.com/aldy505/phc-crypto/yescrypt"
+)
+
+// Hasher is a password hashing scheme that can be registered with Register.
+// The Config type of every algorithm package (argon2, bcrypt, pbkdf2, scrypt, shacrypt, yescrypt) implements it.
+type Hasher interface {
+	// Hash returns a hash of the plain text.
+	Hash(plain string) (string, error)
+	// Verify checks the hash if it's equal (by an algorithm) to plain text provided.
+	Verify(hash, plain string) (bool, error)
+	// NeedsRehash checks whether the hash should be recomputed by the Hasher.
+	NeedsRehash(hash string) (bool, error)
+	// IDs returns the identifiers of the hashes that the Hasher can verify.
+	// For PHC strings, it's the part between the first two dollar signs.
+	// For LDAP schemes, it's the scheme in upper case with its braces ("{SSHA}").
+	IDs() []string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Hasher)
+)
+
+func init() {
+	Register(argon2.Config{})
+	Register(bcrypt.Config{})
+	Register(pbkdf2.Config{})
+	Register(scrypt.Config{})
+	Register(shacrypt.Config{})
+	Register(yescrypt.Config{})
+	Register(legacy.Config{})
+}
+
+// Register makes a Hasher available to Verify for every identifier returned by its IDs method.
+// A Hasher registered for an identifier that is already registered replaces the previous one,
+// which can be used to verify hashes with a different config than the default one.
+//
+//	phccrypto.Register(myLegacyHasher{})
+//
+//	verify, err := phccrypto.Verify("$my-legacy$v=1$...", "password123")
+//	if err != nil {
+//		fmt.Println(err)
+//	}
+//	fmt.Println(verify) // returns boolean (true/false)
+func Register(hasher Hasher) {
+	if hasher == nil {
+		panic("phccrypto: Register hasher is nil")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, id := range hasher.IDs() {
+		registry[id] = hasher
+	}
+}
+
+// lookup returns the Hasher registered for the identifier of the hash.
+func lookup(hash string) (Hasher, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	hasher, ok := registry[identify(hash)]
+	return hasher, ok
+}
+
+// identify returns the identifier of the hash, which is the part between the first two dollar signs,
+// or the scheme of a LDAP hash in upper case with its braces.
+func identify(hash string) string {
+	if strings.HasPrefix(hash, "{") {
+		scheme, _, found := strings.Cut(hash, "}")
+		if !found {
+			return ""
+		}
+		return strings.ToUpper(scheme) + "}"
+	}
+	if !strings.HasPrefix(hash, "$") {
+		return ""
+	}
+	id, _, _ := strings.Cut(hash[1:], "$")
+	return id
+}
+
+// hasIdentifier reports whether the identifier of the hash is one of the identifiers of the Hasher.
+func hasIdentifier(hasher Hasher, hash string) bool {
+	id := identify(hash)
+	for _, v := range hasher.IDs() {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
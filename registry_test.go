@@ -0,0 +1,104 @@
+package phccrypto_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	phccrypto "github.com/aldy505/phc-crypto"
+	"github.com/aldy505/phc-crypto/argon2"
+	"github.com/aldy505/phc-crypto/bcrypt"
+	"github.com/aldy505/phc-crypto/legacy"
+	"github.com/aldy505/phc-crypto/pbkdf2"
+	"github.com/aldy505/phc-crypto/scrypt"
+	"github.com/aldy505/phc-crypto/shacrypt"
+	"github.com/aldy505/phc-crypto/yescrypt"
+)
+
+var (
+	_ phccrypto.Hasher = argon2.Config{}
+	_ phccrypto.Hasher = bcrypt.Config{}
+	_ phccrypto.Hasher = pbkdf2.Config{}
+	_ phccrypto.Hasher = scrypt.Config{}
+	_ phccrypto.Hasher = shacrypt.Config{}
+	_ phccrypto.Hasher = yescrypt.Config{}
+	_ phccrypto.Hasher = legacy.Config{}
+)
+
+// reverseHasher is a toy scheme that stores the reversed plain text.
+type reverseHasher struct{}
+
+func (reverseHasher) Hash(plain string) (string, error) {
+	return "$reverse$" + reverse(plain), nil
+}
+
+func (reverseHasher) Verify(hash, plain string) (bool, error) {
+	if !strings.HasPrefix(hash, "$reverse$") {
+		return false, errors.New("hashed string is not reverse instance")
+	}
+	return strings.TrimPrefix(hash, "$reverse$") == reverse(plain), nil
+}
+
+func (reverseHasher) NeedsRehash(hash string) (bool, error) {
+	return false, nil
+}
+
+func (reverseHasher) IDs() []string {
+	return []string{"reverse"}
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+func TestRegister(t *testing.T) {
+	t.Run("should dispatch to registered hasher", func(t *testing.T) {
+		phccrypto.Register(reverseHasher{})
+
+		verify, err := phccrypto.Verify("$reverse$321drowssap", "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+
+		verify, err = phccrypto.Verify("$reverse$321drowssap", "password321")
+		if err != nil {
+			t.Error(err)
+		}
+		if verify {
+			t.Error("verify function returned true")
+		}
+	})
+
+	t.Run("should rehash registered hasher into the configured algorithm", func(t *testing.T) {
+		phccrypto.Register(reverseHasher{})
+
+		crypto, err := phccrypto.Use(phccrypto.Bcrypt, phccrypto.Config{Rounds: 4})
+		if err != nil {
+			t.Error(err)
+		}
+
+		verify, upgraded, err := crypto.VerifyAndUpgrade("$reverse$321drowssap", "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify || !strings.HasPrefix(upgraded, "$bcrypt$") {
+			t.Error("hash was not upgraded:", verify, upgraded)
+		}
+	})
+
+	t.Run("should panic on nil hasher", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("register should have panicked")
+			}
+		}()
+		phccrypto.Register(nil)
+	})
+}
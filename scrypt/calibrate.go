@@ -0,0 +1,72 @@
+package scrypt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/internal/calibrate"
+)
+
+// Calibrate benchmarks scrypt on the host and returns a Config whose hashes take about
+// target to be created, with up to memoryBudget bytes of memory per hash (128 * N * r).
+// The cost (N) is set to the largest power of 2 that fits in the budget, and halved while
+// a hash takes longer than target. The parallelism is then raised to fill the target,
+// as it adds time without adding memory. The parameters never exceed DefaultLimits,
+// so the hashes are accepted by Verify.
+//
+// Calibrate hashes several times, so it takes a few times the target to return.
+//
+//	import (
+//	  "fmt"
+//	  "time"
+//	  "github.com/aldy505/phc-crypto/scrypt"
+//	)
+//
+//	func main() {
+//	  config, err := scrypt.Calibrate(500*time.Millisecond, 64<<20)
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(config.Cost, config.Parallelism) // 65536 2, depending on the host
+//	}
+func Calibrate(target time.Duration, memoryBudget int) (Config, error) {
+	if err := calibrate.CheckTarget(target); err != nil {
+		return Config{}, err
+	}
+
+	config := Config{
+		Cost:        2,
+		Rounds:      ROUNDS,
+		Parallelism: 1,
+	}
+	budget := min(memoryBudget, DefaultLimits.MaxMemory)
+	if 128*config.Cost*config.Rounds > budget {
+		return Config{}, fmt.Errorf("%w: memory budget must be at least %d bytes", format.ErrInvalidParam, 128*config.Cost*config.Rounds)
+	}
+	for 128*config.Cost*2*config.Rounds <= budget && config.Cost*2 <= DefaultLimits.MaxCost {
+		config.Cost *= 2
+	}
+
+	elapsed, err := measure(config)
+	if err != nil {
+		return Config{}, err
+	}
+	for elapsed > target && config.Cost > 2 {
+		config.Cost /= 2
+		if elapsed, err = measure(config); err != nil {
+			return Config{}, err
+		}
+	}
+
+	config.Parallelism = calibrate.Scale(config.Parallelism, elapsed, target, 1, DefaultLimits.MaxParallelism)
+	return config, nil
+}
+
+// measure returns the duration of a hash with config.
+func measure(config Config) (time.Duration, error) {
+	return calibrate.Measure(func() error {
+		_, err := Hash("password", config)
+		return err
+	})
+}
@@ -4,11 +4,13 @@ import (
 	"crypto/rand"
 	"crypto/subtle"
 	"errors"
+	"fmt"
 	"io"
-	"strconv"
+	"math/bits"
 	"strings"
 
 	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/internal/sealed"
 	"golang.org/x/crypto/scrypt"
 )
 
@@ -19,6 +21,37 @@ type Config struct {
 	Parallelism int
 	KeyLen      int
 	SaltLen     int
+	// Rand is the source of the salt, crypto/rand.Reader when nil.
+	Rand io.Reader
+	// Limits caps the parameters of the hashes accepted by Verify.
+	// Empty fields fall back to DefaultLimits.
+	Limits Limits
+}
+
+// Limits caps the parameters that Verify accepts from a hash, so that a hash with
+// a hostile cost can't exhaust the memory or the CPU of the verifier.
+// The check is done before any hashing work starts, and a hash that exceeds
+// any of the limits is rejected with format.ErrLimitExceeded.
+type Limits struct {
+	// MaxCost is the maximum iterations count (N)
+	MaxCost int
+	// MaxMemory is the maximum amount of memory in bytes, computed as 128 * N * r
+	MaxMemory int
+	// MaxParallelism is the maximum parallelism factor (p)
+	MaxParallelism int
+	// MaxKeyLen is the maximum length of the hash in bytes
+	MaxKeyLen int
+	// MaxSaltLen is the maximum length of the salt in bytes
+	MaxSaltLen int
+}
+
+// DefaultLimits are the limits used by Verify, and by Config.Verify for the empty fields of Config.Limits.
+var DefaultLimits = Limits{
+	MaxCost:        1 << 20,
+	MaxMemory:      1 << 30,
+	MaxParallelism: 16,
+	MaxKeyLen:      1024,
+	MaxSaltLen:     1024,
 }
 
 const (
@@ -36,9 +69,26 @@ const (
 	SALT_LENGTH = 16
 )
 
+// OWASP is the configuration of the OWASP Password Storage Cheat Sheet: N=2^17, r=8 and p=1,
+// which takes 128 MiB of memory per hash.
+var OWASP = Config{
+	Cost:        1 << 17,
+	Rounds:      8,
+	Parallelism: 1,
+	KeyLen:      32,
+	SaltLen:     16,
+}
+
 var ErrEmptyField error = errors.New("function parameters must not be empty")
+var ErrUnsupportedVersion error = errors.New("unsupported scrypt version")
+
+// legacyVersion is the version of the hashes created by the previous versions of this package,
+// which hold the iterations count N itself in the ln parameter instead of log2(N).
+const legacyVersion = 0
 
-// Hash creates a PHC-formatted hash with config provided
+// Hash creates a PHC-formatted hash with config provided.
+// The hash follows the encoding of passlib and the PHC string format reference,
+// with the iterations count recorded as ln=log2(N) and without a version.
 //
 //	import (
 //		"fmt"
@@ -52,31 +102,19 @@ var ErrEmptyField error = errors.New("function parameters must not be empty")
 //		if err != nil {
 //			fmt.Println(err)
 //		}
-//		fmt.Println(hash) // $scrypt$v=0$p=3,ln=32768,r=8$64ecb15ec1aa81bc403a892efb2289ce$4fc8d3bc...
+//		fmt.Println(hash) // $scrypt$ln=15,r=8,p=3$64ecb15ec1aa81bc403a892efb2289ce$4fc8d3bc...
 //	}
 func Hash(plain string, config Config) (string, error) {
 	if plain == "" {
 		return "", ErrEmptyField
 	}
 
-	if config.KeyLen <= 0 {
-		config.KeyLen = KEYLEN
-	}
-	if config.Cost <= 0 {
-		config.Cost = COST
-	}
-	if config.Rounds <= 0 {
-		config.Rounds = ROUNDS
-	}
-	if config.Parallelism <= 0 {
-		config.Parallelism = PARALLELISM
-	}
-	if config.SaltLen <= 0 {
-		config.SaltLen = SALT_LENGTH
-	}
+	config = applyDefaults(config)
 
 	salt := make([]byte, config.SaltLen)
-	io.ReadFull(rand.Reader, salt)
+	if _, err := io.ReadFull(config.Rand, salt); err != nil {
+		return "", fmt.Errorf("reading random reader: %w", err)
+	}
 
 	hash, err := scrypt.Key([]byte(plain), salt, config.Cost, config.Rounds, config.Parallelism, config.KeyLen)
 	if err != nil {
@@ -84,12 +122,12 @@ func Hash(plain string, config Config) (string, error) {
 	}
 
 	hashString := format.Serialize(format.PHCConfig{
-		ID:      "scrypt",
-		Version: 0,
-		Params: map[string]interface{}{
-			"ln": config.Cost,
-			"r":  config.Rounds,
-			"p":  config.Parallelism,
+		ID:          "scrypt",
+		OmitVersion: true,
+		OrderedParams: []format.Param{
+			{Name: "ln", Value: bits.TrailingZeros(uint(config.Cost))},
+			{Name: "r", Value: config.Rounds},
+			{Name: "p", Value: config.Parallelism},
 		},
 		Salt: salt[:],
 		Hash: hash[:],
@@ -99,6 +137,8 @@ func Hash(plain string, config Config) (string, error) {
 }
 
 // Verify checks the hash if it's equal (by an algorithm) to plain text provided.
+// Hashes created by the previous versions of this package, tagged with v=0 and
+// holding N itself in the ln parameter, are verified as well.
 //
 //	import (
 //		"fmt"
@@ -106,7 +146,7 @@ func Hash(plain string, config Config) (string, error) {
 //	)
 //
 //	func main() {
-//		hash := "$scrypt$v=0$p=3,ln=32768,r=8$64ecb15ec1aa81bc403a892efb2289ce$4fc8d3bc..."
+//		hash := "$scrypt$ln=15,r=8,p=3$64ecb15ec1aa81bc403a892efb2289ce$4fc8d3bc..."
 //
 //		verify, err := scrypt.Verify(hash, "password")
 //		if err != nil {
@@ -115,7 +155,29 @@ func Hash(plain string, config Config) (string, error) {
 //		fmt.Println(verify) // true
 //	}
 func Verify(hash string, plain string) (bool, error) {
-	if hash == "" || plain == "" {
+	return Config{}.Verify(hash, plain)
+}
+
+// NeedsRehash checks whether the hash was created with weaker parameters
+// (cost, rounds, parallelism, salt length or key length) than the config provided.
+// Hashes in the legacy encoding (v=0) always need rehash.
+//
+//	import (
+//		"fmt"
+//		"github.com/aldy505/phc-crypto/scrypt"
+//	)
+//
+//	func main() {
+//		hash := "$scrypt$ln=15,r=8,p=3$64ecb15ec1aa81bc403a892efb2289ce$4fc8d3bc..."
+//
+//		rehash, err := scrypt.NeedsRehash(hash, scrypt.Config{Cost: 65536})
+//		if err != nil {
+//			fmt.Println(err)
+//		}
+//		fmt.Println(rehash) // true
+//	}
+func NeedsRehash(hash string, config Config) (bool, error) {
+	if hash == "" {
 		return false, ErrEmptyField
 	}
 
@@ -128,24 +190,171 @@ func Verify(hash string, plain string) (bool, error) {
 		return false, errors.New("hashed string is not scrypt instance")
 	}
 
-	var verifyHash []byte
+	config = applyDefaults(config)
 
-	keyLen := uint32(len(deserialize.Hash))
-
-	cost, err := strconv.ParseUint(deserialize.Params["ln"].(string), 10, 32)
+	cost, rounds, parallelism, err := parseParams(deserialize)
 	if err != nil {
 		return false, err
 	}
-	rounds, err := strconv.ParseUint(deserialize.Params["r"].(string), 10, 32)
+
+	if !deserialize.OmitVersion {
+		return true, nil
+	}
+
+	return cost < uint64(config.Cost) ||
+		uint64(rounds) < uint64(config.Rounds) ||
+		uint64(parallelism) < uint64(config.Parallelism) ||
+		len(deserialize.Salt) < config.SaltLen ||
+		len(deserialize.Hash) < config.KeyLen, nil
+}
+
+// parseParams reads the parameters of a deserialized hash, making sure that
+// there are no unknown parameters and that the values are usable by scrypt.
+// The returned cost is the iterations count N, for both the standard and the legacy encoding.
+func parseParams(deserialize format.PHCConfig) (cost uint64, rounds, parallelism uint32, err error) {
+	if err = deserialize.CheckParams("ln", "r", "p"); err != nil {
+		return
+	}
+
+	ln, err := deserialize.Uint32("ln")
+	if err != nil {
+		return
+	}
+	if deserialize.OmitVersion {
+		if ln < 1 || ln > 63 {
+			err = fmt.Errorf("%w: ln must be between 1 and 63", format.ErrInvalidParam)
+			return
+		}
+		cost = 1 << ln
+	} else {
+		if deserialize.Version != legacyVersion {
+			err = fmt.Errorf("%w: v=%d", ErrUnsupportedVersion, deserialize.Version)
+			return
+		}
+		if ln < 2 || ln&(ln-1) != 0 {
+			err = fmt.Errorf("%w: ln must be a power of 2 greater than 1", format.ErrInvalidParam)
+			return
+		}
+		cost = uint64(ln)
+	}
+
+	rounds, err = deserialize.Uint32("r")
+	if err != nil {
+		return
+	}
+	if rounds < 1 {
+		err = fmt.Errorf("%w: r must be at least 1", format.ErrInvalidParam)
+		return
+	}
+
+	parallelism, err = deserialize.Uint32("p")
+	if err != nil {
+		return
+	}
+	if parallelism < 1 {
+		err = fmt.Errorf("%w: p must be at least 1", format.ErrInvalidParam)
+		return
+	}
+	return
+}
+
+// checkLimits makes sure that none of the parameters of a hash exceeds the limits.
+func checkLimits(limits Limits, cost uint64, rounds, parallelism uint32, saltLen, keyLen int) error {
+	limits = applyDefaultLimits(limits)
+	switch {
+	case cost > uint64(limits.MaxCost):
+		return fmt.Errorf("%w: N=%d is above %d", format.ErrLimitExceeded, cost, limits.MaxCost)
+	case uint64(rounds) > uint64(limits.MaxMemory)/128/cost:
+		return fmt.Errorf("%w: memory of N=%d and r=%d is above %d bytes", format.ErrLimitExceeded, cost, rounds, limits.MaxMemory)
+	case uint64(parallelism) > uint64(limits.MaxParallelism):
+		return fmt.Errorf("%w: p=%d is above %d", format.ErrLimitExceeded, parallelism, limits.MaxParallelism)
+	case saltLen > limits.MaxSaltLen:
+		return fmt.Errorf("%w: salt length %d is above %d", format.ErrLimitExceeded, saltLen, limits.MaxSaltLen)
+	case keyLen > limits.MaxKeyLen:
+		return fmt.Errorf("%w: key length %d is above %d", format.ErrLimitExceeded, keyLen, limits.MaxKeyLen)
+	}
+	return nil
+}
+
+// applyDefaultLimits fills the empty fields of limits with DefaultLimits.
+func applyDefaultLimits(limits Limits) Limits {
+	if limits.MaxCost <= 0 {
+		limits.MaxCost = DefaultLimits.MaxCost
+	}
+	if limits.MaxMemory <= 0 {
+		limits.MaxMemory = DefaultLimits.MaxMemory
+	}
+	if limits.MaxParallelism <= 0 {
+		limits.MaxParallelism = DefaultLimits.MaxParallelism
+	}
+	if limits.MaxKeyLen <= 0 {
+		limits.MaxKeyLen = DefaultLimits.MaxKeyLen
+	}
+	if limits.MaxSaltLen <= 0 {
+		limits.MaxSaltLen = DefaultLimits.MaxSaltLen
+	}
+	return limits
+}
+
+// applyDefaults fills the empty fields of config with the package defaults.
+func applyDefaults(config Config) Config {
+	if config.KeyLen <= 0 {
+		config.KeyLen = KEYLEN
+	}
+	if config.Cost <= 0 {
+		config.Cost = COST
+	}
+	if config.Rounds <= 0 {
+		config.Rounds = ROUNDS
+	}
+	if config.Parallelism <= 0 {
+		config.Parallelism = PARALLELISM
+	}
+	if config.SaltLen <= 0 {
+		config.SaltLen = SALT_LENGTH
+	}
+	if config.Rand == nil {
+		config.Rand = rand.Reader
+	}
+	return config
+}
+
+// Hash creates a PHC-formatted hash with the config. See the package-level Hash function.
+func (c Config) Hash(plain string) (string, error) {
+	return Hash(plain, c)
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided,
+// rejecting hashes whose parameters exceed c.Limits. See the package-level Verify function.
+func (c Config) Verify(hash, plain string) (bool, error) {
+	if hash == "" || plain == "" {
+		return false, ErrEmptyField
+	}
+
+	deserialize, err := format.Deserialize(hash)
 	if err != nil {
 		return false, err
 	}
-	parallelism, err := strconv.ParseUint(deserialize.Params["p"].(string), 10, 32)
+
+	if !strings.HasPrefix(deserialize.ID, "scrypt") {
+		return false, errors.New("hashed string is not scrypt instance")
+	}
+
+	if len(deserialize.Hash) == 0 {
+		return false, format.ErrMissingHash
+	}
+	keyLen := uint32(len(deserialize.Hash))
+
+	cost, rounds, parallelism, err := parseParams(deserialize)
 	if err != nil {
 		return false, err
 	}
 
-	verifyHash, err = scrypt.Key([]byte(plain), deserialize.Salt, int(cost), int(rounds), int(parallelism), int(keyLen))
+	if err := checkLimits(c.Limits, cost, rounds, parallelism, len(deserialize.Salt), len(deserialize.Hash)); err != nil {
+		return false, err
+	}
+
+	verifyHash, err := scrypt.Key([]byte(plain), deserialize.Salt, int(cost), int(rounds), int(parallelism), int(keyLen))
 	if err != nil {
 		return false, err
 	}
@@ -155,3 +364,17 @@ func Verify(hash string, plain string) (bool, error) {
 	}
 	return false, nil
 }
+
+// NeedsRehash checks whether the hash is weaker than the config. See the package-level NeedsRehash function.
+func (c Config) NeedsRehash(hash string) (bool, error) {
+	return NeedsRehash(hash, c)
+}
+
+// UseConfig makes Config a config of phccrypto.Use, which names every parameter the way
+// the algorithm does. It can only be called by the packages of this module.
+func (c Config) UseConfig(sealed.Token) {}
+
+// IDs returns the PHC identifiers of the hashes that this package can verify.
+func (c Config) IDs() []string {
+	return []string{"scrypt"}
+}
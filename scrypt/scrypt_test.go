@@ -1,9 +1,13 @@
 package scrypt_test
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aldy505/phc-crypto/format"
 	"github.com/aldy505/phc-crypto/scrypt"
 )
 
@@ -142,3 +146,288 @@ func TestError(t *testing.T) {
 		}
 	})
 }
+
+func TestNeedsRehash(t *testing.T) {
+	config := scrypt.Config{
+		Cost:        1024,
+		Rounds:      8,
+		Parallelism: 2,
+		KeyLen:      32,
+		SaltLen:     16,
+	}
+
+	hash, err := scrypt.Hash("password123", config)
+	if err != nil {
+		t.Error(err)
+	}
+
+	t.Run("should return false on the same config", func(t *testing.T) {
+		rehash, err := scrypt.NeedsRehash(hash, config)
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+	})
+
+	t.Run("should return true on stronger config", func(t *testing.T) {
+		stronger := []scrypt.Config{
+			{Cost: 2048, Rounds: 8, Parallelism: 2, KeyLen: 32, SaltLen: 16},
+			{Cost: 1024, Rounds: 16, Parallelism: 2, KeyLen: 32, SaltLen: 16},
+			{Cost: 1024, Rounds: 8, Parallelism: 3, KeyLen: 32, SaltLen: 16},
+			{Cost: 1024, Rounds: 8, Parallelism: 2, KeyLen: 64, SaltLen: 16},
+			{Cost: 1024, Rounds: 8, Parallelism: 2, KeyLen: 32, SaltLen: 32},
+		}
+		for _, c := range stronger {
+			rehash, err := scrypt.NeedsRehash(hash, c)
+			if err != nil {
+				t.Error(err)
+			}
+			if !rehash {
+				t.Error("needs rehash function returned false for", c)
+			}
+		}
+	})
+
+	t.Run("should return error", func(t *testing.T) {
+		_, err := scrypt.NeedsRehash("$str$v=0$ln=100,r=8,p=2$invalidSalt$invalidHash", config)
+		if err == nil || err.Error() != "hashed string is not scrypt instance" {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	testCases := []struct {
+		name string
+		hash string
+		err  error
+	}{
+		{"missing param", "$scrypt$v=0$ln=16,r=8$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrMissingParam},
+		{"duplicate param", "$scrypt$v=0$ln=16,r=8,p=1,r=2$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrDuplicateParam},
+		{"unknown param", "$scrypt$v=0$ln=16,r=8,p=1,x=2$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrUnknownParam},
+		{"missing hash", "$scrypt$v=0$ln=16,r=8,p=1$c2FsdHNhbHQ", format.ErrMissingHash},
+		{"zero rounds", "$scrypt$v=0$ln=16,r=0,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrInvalidParam},
+		{"zero parallelism", "$scrypt$v=0$ln=16,r=8,p=0$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrInvalidParam},
+		{"cost not a power of 2", "$scrypt$v=0$ln=15,r=8,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", format.ErrInvalidParam},
+		{"truncated", "$scrypt$", format.ErrInvalidFormat},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := scrypt.Verify(tc.hash, "password123")
+			if !errors.Is(err, tc.err) {
+				t.Error("error should have been thrown:", err)
+			}
+		})
+	}
+}
+
+func FuzzVerify(f *testing.F) {
+	hash, err := scrypt.Hash("password123", scrypt.Config{Cost: 16, Rounds: 1, Parallelism: 1, KeyLen: 16, SaltLen: 8})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(hash, "password123")
+	f.Add("$scrypt$v=0$ln=16,r=8$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "password123")
+	f.Add("$scrypt$v=0$ln=16,r=8,p=1$c2FsdHNhbHQ", "password123")
+	f.Add("$scrypt$v=0$ln=16,r=0,p=0$$AA", "password123")
+	f.Add("$scrypt$ln=4,r=1,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ", "password123")
+	f.Add("$scrypt$", "password123")
+	f.Add("$x$v=1$m$a$b", "password123")
+
+	f.Fuzz(func(t *testing.T, hash string, plain string) {
+		_, _ = scrypt.Verify(hash, plain)
+		_, _ = scrypt.NeedsRehash(hash, scrypt.Config{})
+	})
+}
+
+func TestVerifyLimits(t *testing.T) {
+	t.Run("should reject hashes above the default limits", func(t *testing.T) {
+		testCases := []struct {
+			name string
+			hash string
+		}{
+			{"cost", "$scrypt$v=0$ln=2147483648,r=1,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ"},
+			{"memory", "$scrypt$v=0$ln=1048576,r=16,p=1$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ"},
+			{"parallelism", "$scrypt$v=0$ln=16,r=8,p=2147483647$c2FsdHNhbHQ$6ZpTDRZkDxv4K3Ig7dd0UQ"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := scrypt.Verify(tc.hash, "password123")
+				if !errors.Is(err, format.ErrLimitExceeded) {
+					t.Error("error should have been thrown:", err)
+				}
+			})
+		}
+	})
+
+	t.Run("should enforce the limits of the config", func(t *testing.T) {
+		hash, err := scrypt.Hash("password123", scrypt.Config{Cost: 16, Rounds: 2, Parallelism: 2, KeyLen: 16, SaltLen: 8})
+		if err != nil {
+			t.Error(err)
+		}
+
+		testCases := []struct {
+			name   string
+			limits scrypt.Limits
+		}{
+			{"cost", scrypt.Limits{MaxCost: 8}},
+			{"memory", scrypt.Limits{MaxMemory: 128 * 16}},
+			{"parallelism", scrypt.Limits{MaxParallelism: 1}},
+			{"key length", scrypt.Limits{MaxKeyLen: 8}},
+			{"salt length", scrypt.Limits{MaxSaltLen: 4}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := scrypt.Config{Limits: tc.limits}.Verify(hash, "password123")
+				if !errors.Is(err, format.ErrLimitExceeded) {
+					t.Error("error should have been thrown:", err)
+				}
+			})
+		}
+
+		verify, err := scrypt.Config{Limits: scrypt.Limits{MaxCost: 16, MaxMemory: 128 * 16 * 2, MaxParallelism: 2}}.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+}
+
+func TestEncoding(t *testing.T) {
+	t.Run("should encode ln as log2 of the cost", func(t *testing.T) {
+		hash, err := scrypt.Hash("password123", scrypt.Config{Cost: 1024, Parallelism: 2})
+		if err != nil {
+			t.Error(err)
+		}
+		if !strings.HasPrefix(hash, "$scrypt$ln=10,r=8,p=2$") {
+			t.Error("unexpected encoding:", hash)
+		}
+	})
+
+	t.Run("should verify passlib hashes", func(t *testing.T) {
+		hash := "$scrypt$ln=16,r=8,p=1$aM15713r3Xsvxbi31lqr1Q$nFNh2CVHVjNldFVKDHDlm4CbdRSCdEBsjjJxD+iCs5E"
+		verify, err := scrypt.Verify(hash, "password")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should verify and rehash legacy hashes", func(t *testing.T) {
+		hash := "$scrypt$v=0$ln=1024,r=8,p=1$bGVnYWN5c2FsdGxlZ2FjeQ$wlipAYM0XhECKEDTHFAgM5pFD6QeLaj6RdkxStKTU08"
+		verify, err := scrypt.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+
+		rehash, err := scrypt.NeedsRehash(hash, scrypt.Config{Cost: 1024, Parallelism: 1, SaltLen: 16})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("legacy hash should need rehash")
+		}
+	})
+
+	t.Run("should return error on invalid encoding", func(t *testing.T) {
+		_, err := scrypt.Verify("$scrypt$v=1$ln=1024,r=8,p=1$bGVnYWN5c2FsdGxlZ2FjeQ$wlipAYM0XhECKEDTHFAgM5pFD6QeLaj6RdkxStKTU08", "password123")
+		if !errors.Is(err, scrypt.ErrUnsupportedVersion) {
+			t.Error("error should have been thrown:", err)
+		}
+
+		_, err = scrypt.Verify("$scrypt$ln=64,r=8,p=1$bGVnYWN5c2FsdGxlZ2FjeQ$wlipAYM0XhECKEDTHFAgM5pFD6QeLaj6RdkxStKTU08", "password123")
+		if !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("error should have been thrown:", err)
+		}
+
+		_, err = scrypt.Verify("$scrypt$ln=40,r=8,p=1$bGVnYWN5c2FsdGxlZ2FjeQ$wlipAYM0XhECKEDTHFAgM5pFD6QeLaj6RdkxStKTU08", "password123")
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("error should have been thrown:", err)
+		}
+	})
+}
+
+func TestCalibrate(t *testing.T) {
+	t.Run("should stay within the budget and the limits", func(t *testing.T) {
+		config, err := scrypt.Calibrate(20*time.Millisecond, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if 128*config.Cost*config.Rounds > 1<<20 || config.Parallelism < 1 || config.Parallelism > scrypt.DefaultLimits.MaxParallelism {
+			t.Errorf("unexpected config: %+v", config)
+		}
+
+		hash, err := scrypt.Hash("password123", config)
+		if err != nil {
+			t.Error(err)
+		}
+		verify, err := scrypt.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should lower the cost for a short target", func(t *testing.T) {
+		config, err := scrypt.Calibrate(time.Nanosecond, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Cost != 2 || config.Parallelism != 1 {
+			t.Errorf("unexpected config: %+v", config)
+		}
+	})
+
+	t.Run("should return error on invalid arguments", func(t *testing.T) {
+		if _, err := scrypt.Calibrate(-time.Second, 1<<20); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("expected ErrInvalidParam, got:", err)
+		}
+		if _, err := scrypt.Calibrate(time.Second, 1024); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("expected ErrInvalidParam, got:", err)
+		}
+	})
+}
+
+func TestPresets(t *testing.T) {
+	t.Run("OWASP should be accepted by Verify", func(t *testing.T) {
+		hash, err := scrypt.Hash("password123", scrypt.OWASP)
+		if err != nil {
+			t.Error(err)
+		}
+		verify, err := scrypt.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should rehash the hashes of the defaults", func(t *testing.T) {
+		hash, err := scrypt.Hash("password123", scrypt.Config{})
+		if err != nil {
+			t.Error(err)
+		}
+		rehash, err := scrypt.NeedsRehash(hash, scrypt.OWASP)
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package shacrypt
+
+import (
+	"time"
+
+	"github.com/aldy505/phc-crypto/internal/calibrate"
+)
+
+// calibrationRounds is the rounds count that Calibrate measures.
+const calibrationRounds = 10000
+
+// Calibrate benchmarks SHA-crypt of the variant on the host and returns a Config whose
+// hashes take about target to be created. SHA-crypt uses a fixed amount of memory,
+// so only the rounds are calibrated, which the duration grows linearly with.
+// The rounds never exceed DefaultLimits, so the hashes are accepted by Verify.
+//
+//	import (
+//	  "fmt"
+//	  "time"
+//	  "github.com/aldy505/phc-crypto/shacrypt"
+//	)
+//
+//	func main() {
+//	  config, err := shacrypt.Calibrate(shacrypt.SHA512, 250*time.Millisecond)
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(config.Rounds) // 656000, depending on the host
+//	}
+func Calibrate(variant Variant, target time.Duration) (Config, error) {
+	if err := calibrate.CheckTarget(target); err != nil {
+		return Config{}, err
+	}
+
+	config := Config{Rounds: calibrationRounds, Variant: variant}
+	elapsed, err := calibrate.Measure(func() error {
+		_, err := Hash("password", config)
+		return err
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	config.Rounds = calibrate.Scale(config.Rounds, elapsed, target, minRounds, DefaultLimits.MaxRounds)
+	return config, nil
+}
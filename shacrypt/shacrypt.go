@@ -0,0 +1,423 @@
+// Package shacrypt implements SHA-256-crypt and SHA-512-crypt, the $5$ and $6$ schemes of
+// /etc/shadow and of many LDAP directories, as specified by Ulrich Drepper
+// (https://www.akkadia.org/drepper/SHA-crypt.txt).
+package shacrypt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/phc-crypto/format"
+)
+
+// Config initialize the config require to create a hash function
+type Config struct {
+	Rounds  int
+	Variant Variant
+	// SaltLen is the length of the salt in characters, at most 16.
+	SaltLen int
+	// Limits caps the parameters of the hashes accepted by Verify.
+	// Empty fields fall back to DefaultLimits.
+	Limits Limits
+}
+
+// Limits caps the parameters that Verify accepts from a hash, so that a hash with
+// a hostile rounds count can't pin the CPU of the verifier.
+// The check is done before any hashing work starts, and a hash that exceeds
+// any of the limits is rejected with format.ErrLimitExceeded.
+type Limits struct {
+	// MaxRounds is the maximum rounds count
+	MaxRounds int
+}
+
+// DefaultLimits are the limits used by Verify, and by Config.Verify for the empty fields of Config.Limits.
+var DefaultLimits = Limits{
+	MaxRounds: 5_000_000,
+}
+
+// Variant sets up enum for available SHA-crypt variants.
+type Variant int
+
+const (
+	// SHA512 points to SHA-512-crypt ($6$)
+	SHA512 Variant = iota
+	// SHA256 points to SHA-256-crypt ($5$)
+	SHA256
+)
+
+const (
+	// ROUNDS is the rounds count, minimum of 1000, maximum of 999999999.
+	ROUNDS = 656000
+	// SALT_LENGTH is the default salt length in characters, which is also the maximum.
+	SALT_LENGTH = 16
+)
+
+var ErrEmptyField error = errors.New("function parameters must not be empty")
+var ErrInvalidVariant error = errors.New("invalid sha-crypt variant")
+
+const (
+	// defaultRounds is the rounds count of the hashes without a rounds= parameter.
+	defaultRounds = 5000
+	minRounds     = 1000
+	maxRounds     = 999999999
+	maxSaltLength = 16
+)
+
+// cryptAlphabet is the base64 alphabet of crypt(3), in which the salt and the hash are encoded.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var cryptEncoding = base64.NewEncoding(cryptAlphabet).WithPadding(base64.NoPadding)
+
+// sha256Order and sha512Order are the byte orders in which the digests are encoded,
+// three bytes (one group of four characters) at a time. The last group holds the remaining bytes.
+var (
+	sha256Order = []int{
+		0, 10, 20, 21, 1, 11, 12, 22, 2, 3, 13, 23, 24, 4, 14,
+		15, 25, 5, 6, 16, 26, 27, 7, 17, 18, 28, 8, 9, 19, 29,
+		31, 30,
+	}
+	sha512Order = []int{
+		0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4,
+		47, 5, 26, 6, 27, 48, 28, 49, 7, 50, 8, 29, 9, 30, 51,
+		31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55, 13, 56, 14, 35,
+		15, 36, 57, 37, 58, 16, 59, 17, 38, 18, 39, 60, 40, 61, 19,
+		62, 20, 41, 63,
+	}
+)
+
+// Hash creates a SHA-crypt hash with config provided, formatted as $<id>$rounds=<rounds>$<salt>$<hash>.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/shacrypt"
+//	)
+//
+//	func main() {
+//	  hash, err := shacrypt.Hash("password", shacrypt.Config{
+//	    Rounds: 100000,
+//	  })
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(hash) // $6$rounds=100000$N9qo8uLOickgx2ZM$LakrvQiz.vRTLyTgEIFc32...
+//	}
+func Hash(plain string, config Config) (string, error) {
+	if plain == "" {
+		return "", ErrEmptyField
+	}
+
+	config = applyDefaults(config)
+
+	id := variantID(config.Variant)
+	if id == "" {
+		return "", ErrInvalidVariant
+	}
+	if config.Rounds < minRounds || config.Rounds > maxRounds {
+		return "", fmt.Errorf("%w: rounds must be between %d and %d", format.ErrInvalidParam, minRounds, maxRounds)
+	}
+	if config.SaltLen > maxSaltLength {
+		return "", fmt.Errorf("%w: salt length must be at most %d", format.ErrInvalidParam, maxSaltLength)
+	}
+
+	random := make([]byte, (config.SaltLen*6+7)/8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	salt := cryptEncoding.EncodeToString(random)[:config.SaltLen]
+
+	checksum := sum(config.Variant, []byte(plain), []byte(salt), config.Rounds)
+	return "$" + id + "$rounds=" + strconv.Itoa(config.Rounds) + "$" + salt + "$" + checksum, nil
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided.
+// Hashes without a rounds= parameter use 5000 rounds, and a rounds= parameter outside of
+// 1000 to 999999999 is clamped to the nearest bound, as the specification defines.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/shacrypt"
+//	)
+//
+//	func main() {
+//	  hash := "$5$rounds=1000$N9qo8uLOickgx2ZM$JAgz/kifvyMI8cZtug.uo6Lg8gkKJ1lUf41GeApX2H2"
+//
+//	  verify, err := shacrypt.Verify(hash, "password123")
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(verify) // true
+//	}
+func Verify(hash string, plain string) (bool, error) {
+	return Config{}.Verify(hash, plain)
+}
+
+// NeedsRehash checks whether the hash was created with another variant or with weaker
+// parameters (rounds or salt length) than the config provided.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/shacrypt"
+//	)
+//
+//	func main() {
+//	  hash := "$5$rounds=1000$N9qo8uLOickgx2ZM$JAgz/kifvyMI8cZtug.uo6Lg8gkKJ1lUf41GeApX2H2"
+//
+//	  rehash, err := shacrypt.NeedsRehash(hash, shacrypt.Config{})
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(rehash) // true
+//	}
+func NeedsRehash(hash string, config Config) (bool, error) {
+	if hash == "" {
+		return false, ErrEmptyField
+	}
+
+	variant, rounds, salt, _, err := parseHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	config = applyDefaults(config)
+
+	if variantID(config.Variant) == "" {
+		return false, ErrInvalidVariant
+	}
+
+	return variant != config.Variant ||
+		rounds < config.Rounds ||
+		len(salt) < config.SaltLen, nil
+}
+
+// parseHash reads the variant, the rounds count, the salt and the hash of a SHA-crypt hash.
+func parseHash(hash string) (variant Variant, rounds int, salt, checksum string, err error) {
+	fields := strings.Split(hash, "$")
+	if len(fields) < 4 || fields[0] != "" {
+		err = fmt.Errorf("%w: hash must be formatted as $<id>$[rounds=<rounds>$]<salt>$<hash>", format.ErrInvalidFormat)
+		return
+	}
+
+	switch fields[1] {
+	case "5":
+		variant = SHA256
+	case "6":
+		variant = SHA512
+	default:
+		err = ErrInvalidVariant
+		return
+	}
+
+	rounds = defaultRounds
+	fields = fields[2:]
+	if value, ok := strings.CutPrefix(fields[0], "rounds="); ok {
+		if value == "" || strings.Trim(value, "0123456789") != "" || (value[0] == '0' && len(value) > 1) {
+			err = fmt.Errorf("%w: rounds=%s", format.ErrInvalidDecimal, value)
+			return
+		}
+		// out of range counts are clamped to the nearest bound, as the specification defines,
+		// so that the hashes of glibc and libxcrypt are accepted
+		if len(value) > len(strconv.Itoa(maxRounds)) {
+			rounds = maxRounds
+		} else {
+			rounds, _ = strconv.Atoi(value)
+			rounds = min(max(rounds, minRounds), maxRounds)
+		}
+		fields = fields[1:]
+	}
+
+	if len(fields) != 2 {
+		err = fmt.Errorf("%w: hash must be formatted as $<id>$[rounds=<rounds>$]<salt>$<hash>", format.ErrInvalidFormat)
+		return
+	}
+	salt, checksum = fields[0], fields[1]
+	if len(salt) > maxSaltLength {
+		err = fmt.Errorf("%w: salt must be at most %d characters", format.ErrInvalidFormat, maxSaltLength)
+		return
+	}
+	if checksum == "" {
+		err = format.ErrMissingHash
+		return
+	}
+	return
+}
+
+// variantID returns the identifier of the variant, or an empty string for an unknown variant.
+func variantID(variant Variant) string {
+	switch variant {
+	case SHA256:
+		return "5"
+	case SHA512:
+		return "6"
+	default:
+		return ""
+	}
+}
+
+// sum computes the encoded hash of the plain text, following the steps of the specification.
+func sum(variant Variant, plain, salt []byte, rounds int) string {
+	newHash, order := sha512.New, sha512Order
+	if variant == SHA256 {
+		newHash, order = sha256.New, sha256Order
+	}
+	// digest returns the digest of b repeated count times
+	digest := func(b []byte, count int) []byte {
+		h := newHash()
+		for i := 0; i < count; i++ {
+			h.Write(b)
+		}
+		return h.Sum(nil)
+	}
+
+	// steps 4 to 8, digest B
+	bh := newHash()
+	bh.Write(plain)
+	bh.Write(salt)
+	bh.Write(plain)
+	b := bh.Sum(nil)
+
+	// steps 1 to 3 and 9 to 12, digest A
+	a := newHash()
+	a.Write(plain)
+	a.Write(salt)
+	a.Write(repeat(b, len(plain)))
+	for n := len(plain); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(b)
+		} else {
+			a.Write(plain)
+		}
+	}
+	c := a.Sum(nil)
+
+	// steps 13 to 16, sequence P
+	p := repeat(digest(plain, len(plain)), len(plain))
+
+	// steps 17 to 20, sequence S
+	s := repeat(digest(salt, 16+int(c[0])), len(salt))
+
+	// step 21, the rounds
+	h := newHash()
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(c[:0])
+	}
+
+	return encode(c, order)
+}
+
+// repeat returns the first n bytes of the digest repeated as many times as needed.
+func repeat(digest []byte, n int) []byte {
+	out := make([]byte, 0, n+len(digest))
+	for len(out) < n {
+		out = append(out, digest...)
+	}
+	return out[:n]
+}
+
+// encode encodes the digest in the crypt(3) alphabet, three bytes of the order at a time,
+// least significant bits first.
+func encode(digest []byte, order []int) string {
+	var sb strings.Builder
+	for i := 0; i < len(order); i += 3 {
+		group := order[i:min(i+3, len(order))]
+		var w uint
+		for _, idx := range group {
+			w = w<<8 | uint(digest[idx])
+		}
+		for n := len(group) + 1; n > 0; n-- {
+			sb.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	return sb.String()
+}
+
+// checkLimits makes sure that none of the parameters of a hash exceeds the limits.
+func checkLimits(limits Limits, rounds int) error {
+	limits = applyDefaultLimits(limits)
+	if rounds > limits.MaxRounds {
+		return fmt.Errorf("%w: rounds=%d is above %d", format.ErrLimitExceeded, rounds, limits.MaxRounds)
+	}
+	return nil
+}
+
+// applyDefaultLimits fills the empty fields of limits with DefaultLimits.
+func applyDefaultLimits(limits Limits) Limits {
+	if limits.MaxRounds <= 0 {
+		limits.MaxRounds = DefaultLimits.MaxRounds
+	}
+	return limits
+}
+
+// applyDefaults fills the empty fields of config with the package defaults.
+func applyDefaults(config Config) Config {
+	if config.Rounds <= 0 {
+		config.Rounds = ROUNDS
+	}
+	if config.SaltLen <= 0 {
+		config.SaltLen = SALT_LENGTH
+	}
+	return config
+}
+
+// Hash creates a SHA-crypt hash with the config. See the package-level Hash function.
+func (c Config) Hash(plain string) (string, error) {
+	return Hash(plain, c)
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided,
+// rejecting hashes whose parameters exceed c.Limits. See the package-level Verify function.
+func (c Config) Verify(hash, plain string) (bool, error) {
+	if hash == "" || plain == "" {
+		return false, ErrEmptyField
+	}
+
+	variant, rounds, salt, checksum, err := parseHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	if err := checkLimits(c.Limits, rounds); err != nil {
+		return false, err
+	}
+
+	verifyHash := sum(variant, []byte(plain), []byte(salt), rounds)
+
+	if subtle.ConstantTimeCompare([]byte(checksum), []byte(verifyHash)) == 1 {
+		return true, nil
+	}
+	return false, nil
+}
+
+// NeedsRehash checks whether the hash is weaker than the config. See the package-level NeedsRehash function.
+func (c Config) NeedsRehash(hash string) (bool, error) {
+	return NeedsRehash(hash, c)
+}
+
+// IDs returns the identifiers of the hashes that this package can verify.
+func (c Config) IDs() []string {
+	return []string{"5", "6"}
+}
@@ -0,0 +1,250 @@
+package shacrypt_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/shacrypt"
+)
+
+func TestHash(t *testing.T) {
+	t.Run("should be ok without additional config", func(t *testing.T) {
+		hash, err := shacrypt.Hash("password123", shacrypt.Config{})
+		if err != nil {
+			t.Error(err)
+		}
+		if !strings.HasPrefix(hash, "$6$rounds=656000$") {
+			t.Error("unexpected encoding:", hash)
+		}
+	})
+
+	t.Run("should be ok with additional config", func(t *testing.T) {
+		hash, err := shacrypt.Hash("password123", shacrypt.Config{
+			Rounds:  1000,
+			Variant: shacrypt.SHA256,
+			SaltLen: 8,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		segments := strings.Split(hash, "$")
+		if len(segments) != 5 || segments[1] != "5" || segments[2] != "rounds=1000" || len(segments[3]) != 8 || len(segments[4]) != 43 {
+			t.Error("unexpected encoding:", hash)
+		}
+
+		verify, err := shacrypt.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should return error on invalid config", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			config shacrypt.Config
+			err    error
+		}{
+			{"variant", shacrypt.Config{Variant: 5}, shacrypt.ErrInvalidVariant},
+			{"rounds", shacrypt.Config{Rounds: 999}, format.ErrInvalidParam},
+			{"salt length", shacrypt.Config{SaltLen: 17}, format.ErrInvalidParam},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := shacrypt.Hash("password123", tc.config)
+				if !errors.Is(err, tc.err) {
+					t.Errorf("expected %v, got: %v", tc.err, err)
+				}
+			})
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	testCases := []struct {
+		name  string
+		hash  string
+		plain string
+	}{
+		{"sha256 default rounds", "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world!"},
+		{"sha512 default rounds", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!"},
+		{"sha256 rounds", "$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA", "Hello world!"},
+		{"sha512 rounds", "$6$rounds=1400$anotherlongsalts$5FGyu8c4BZDX4wJgs0Un26YOw2XibT5eTkHF1I1aP3QqStoJI9BHD2YPJYsAjEePVGUyBjdZxcNqMWlrrbIOC.", "Hello world!"},
+		{"sha256", "$5$rounds=1000$N9qo8uLOickgx2ZM$JAgz/kifvyMI8cZtug.uo6Lg8gkKJ1lUf41GeApX2H2", "password123"},
+		{"sha512", "$6$rounds=1000$N9qo8uLOickgx2ZM$LakrvQiz.vRTLyTgEIFc32aVUTL/GxtJg1R8br36KHd8PYPSZs.ZU45aSTOYSu025OWER0Bx2SrOBH6ZaquL3/", "password123"},
+		{"sha256 rounds clamped", "$5$rounds=10$roundstoolow$yfvwcWrQ8l/K0DAWyuPMDNHpIVlTQebY9l/gL972bIC", "the minimum number is still observed"},
+		{"sha512 rounds clamped", "$6$rounds=10$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX.", "the minimum number is still observed"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			verify, err := shacrypt.Verify(tc.hash, tc.plain)
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false")
+			}
+
+			verify, err = shacrypt.Verify(tc.hash, "password321")
+			if err != nil {
+				t.Error(err)
+			}
+			if verify {
+				t.Error("verify function returned true")
+			}
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	t.Run("should complain of empty function parameters", func(t *testing.T) {
+		if _, err := shacrypt.Hash("", shacrypt.Config{}); !errors.Is(err, shacrypt.ErrEmptyField) {
+			t.Error("expected ErrEmptyField, got:", err)
+		}
+		if _, err := shacrypt.Verify("", ""); !errors.Is(err, shacrypt.ErrEmptyField) {
+			t.Error("expected ErrEmptyField, got:", err)
+		}
+		if _, err := shacrypt.NeedsRehash("", shacrypt.Config{}); !errors.Is(err, shacrypt.ErrEmptyField) {
+			t.Error("expected ErrEmptyField, got:", err)
+		}
+	})
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	testCases := []struct {
+		name string
+		hash string
+		err  error
+	}{
+		{"not a sha-crypt hash", "saltstring$5B8vYYiY", format.ErrInvalidFormat},
+		{"unknown identifier", "$7$saltstring$5B8vYYiY", shacrypt.ErrInvalidVariant},
+		{"missing hash", "$5$saltstring$", format.ErrMissingHash},
+		{"too many fields", "$5$rounds=1000$saltstring$5B8vYYiY$", format.ErrInvalidFormat},
+		{"rounds not decimal", "$5$rounds=01000$saltstring$5B8vYYiY", format.ErrInvalidDecimal},
+		{"rounds negative", "$5$rounds=-1000$saltstring$5B8vYYiY", format.ErrInvalidDecimal},
+		{"rounds empty", "$5$rounds=$saltstring$5B8vYYiY", format.ErrInvalidDecimal},
+		{"salt too long", "$5$saltstringsaltstring$5B8vYYiY", format.ErrInvalidFormat},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := shacrypt.Verify(tc.hash, "password123")
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifyLimits(t *testing.T) {
+	t.Run("should reject hashes above the default limits", func(t *testing.T) {
+		_, err := shacrypt.Verify("$6$rounds=999999999$saltstring$5B8vYYiY", "password123")
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("expected ErrLimitExceeded, got:", err)
+		}
+
+		// clamped to 999999999 rounds
+		_, err = shacrypt.Verify("$6$rounds=99999999999999999999$saltstring$5B8vYYiY", "password123")
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("expected ErrLimitExceeded, got:", err)
+		}
+	})
+
+	t.Run("should enforce the limits of the config", func(t *testing.T) {
+		config := shacrypt.Config{Limits: shacrypt.Limits{MaxRounds: 1000}}
+		_, err := config.Verify("$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA", "Hello world!")
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("expected ErrLimitExceeded, got:", err)
+		}
+
+		verify, err := config.Verify("$5$rounds=1000$N9qo8uLOickgx2ZM$JAgz/kifvyMI8cZtug.uo6Lg8gkKJ1lUf41GeApX2H2", "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hash := "$5$rounds=1000$N9qo8uLOickgx2ZM$JAgz/kifvyMI8cZtug.uo6Lg8gkKJ1lUf41GeApX2H2"
+
+	t.Run("should return false on the same config", func(t *testing.T) {
+		rehash, err := shacrypt.NeedsRehash(hash, shacrypt.Config{Rounds: 1000, Variant: shacrypt.SHA256})
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+	})
+
+	t.Run("should return true on stronger config", func(t *testing.T) {
+		rehash, err := shacrypt.NeedsRehash(hash, shacrypt.Config{Variant: shacrypt.SHA256})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should return true on another variant", func(t *testing.T) {
+		rehash, err := shacrypt.NeedsRehash(hash, shacrypt.Config{Rounds: 1000})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should return true without a rounds parameter", func(t *testing.T) {
+		rehash, err := shacrypt.NeedsRehash("$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", shacrypt.Config{Rounds: 10000, Variant: shacrypt.SHA256})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+}
+
+func TestCalibrate(t *testing.T) {
+	t.Run("should stay within the limits", func(t *testing.T) {
+		config, err := shacrypt.Calibrate(shacrypt.SHA512, 20*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Variant != shacrypt.SHA512 || config.Rounds < 1000 || config.Rounds > shacrypt.DefaultLimits.MaxRounds {
+			t.Errorf("unexpected config: %+v", config)
+		}
+	})
+
+	t.Run("should not go below the minimum", func(t *testing.T) {
+		config, err := shacrypt.Calibrate(shacrypt.SHA256, time.Nanosecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Rounds != 1000 {
+			t.Errorf("unexpected config: %+v", config)
+		}
+	})
+
+	t.Run("should return error on invalid arguments", func(t *testing.T) {
+		if _, err := shacrypt.Calibrate(shacrypt.SHA256, 0); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("expected ErrInvalidParam, got:", err)
+		}
+		if _, err := shacrypt.Calibrate(5, time.Second); !errors.Is(err, shacrypt.ErrInvalidVariant) {
+			t.Error("expected ErrInvalidVariant, got:", err)
+		}
+	})
+}
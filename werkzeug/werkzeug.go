@@ -0,0 +1,327 @@
+// Package werkzeug verifies and creates the password hashes of Werkzeug (generate_password_hash
+// and check_password_hash, as used by Flask), by delegating to the pbkdf2 and scrypt packages.
+//
+// The hashes are formatted as method$salt$hash, where the method holds the parameters
+// (pbkdf2:sha256:600000 or scrypt:32768:8:1), the salt is used as text and the hash is hex-encoded.
+package werkzeug
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/internal/salt"
+	"github.com/aldy505/phc-crypto/pbkdf2"
+	"github.com/aldy505/phc-crypto/scrypt"
+)
+
+// Method is the name of a Werkzeug hash method, which prefixes its hashes.
+type Method string
+
+const (
+	// PBKDF2 points to the pbkdf2 method: pbkdf2:<hash function>:<iterations>$<salt>$<hex hash>
+	PBKDF2 Method = "pbkdf2"
+	// Scrypt points to the scrypt method: scrypt:<N>:<r>:<p>$<salt>$<hex hash>
+	Scrypt Method = "scrypt"
+)
+
+// Config initialize the config require to create a hash function.
+// The config of the algorithm packages are used as they are, except for their empty
+// fields, which are filled with the defaults of Werkzeug instead of the package defaults.
+type Config struct {
+	// Method is the Werkzeug method used by Hash, Scrypt when empty.
+	Method Method
+	// HashName is the hashlib name of the hash function of the pbkdf2 method, sha256 when empty.
+	// It takes precedence over PBKDF2.HashFunc.
+	HashName string
+	PBKDF2   pbkdf2.Config
+	Scrypt   scrypt.Config
+}
+
+const (
+	// PBKDF2_ROUNDS is the iterations count of the pbkdf2 method.
+	PBKDF2_ROUNDS = 600000
+	// SCRYPT_COST is the work factor (N) of the scrypt method.
+	SCRYPT_COST = 1 << 15
+	// SCRYPT_KEYLEN is the length of the scrypt hashes in bytes.
+	SCRYPT_KEYLEN = 64
+	// SALT_LENGTH is the length of the salts of Werkzeug, in characters.
+	SALT_LENGTH = 16
+)
+
+var ErrEmptyField error = errors.New("function parameters must not be empty")
+var ErrMethodNotSupported error = errors.New("the method provided is not supported")
+var ErrHashNotSupported error = errors.New("the hash function provided is not supported")
+
+// saltChars is the alphabet of the salts of Werkzeug (werkzeug.security.SALT_CHARS).
+const saltChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// hashFuncs maps the hash functions of the pbkdf2 method, named after hashlib, to the pbkdf2 package.
+var hashFuncs = map[string]pbkdf2.HashFunction{
+	"sha1":   pbkdf2.SHA1,
+	"sha224": pbkdf2.SHA224,
+	"sha256": pbkdf2.SHA256,
+	"sha384": pbkdf2.SHA384,
+	"sha512": pbkdf2.SHA512,
+	"md5":    pbkdf2.MD5,
+}
+
+// digestSizes is the output size of the hash functions, which is the length of the pbkdf2 hashes of Werkzeug.
+var digestSizes = map[pbkdf2.HashFunction]int{
+	pbkdf2.SHA1:   20,
+	pbkdf2.SHA224: 28,
+	pbkdf2.SHA256: 32,
+	pbkdf2.SHA384: 48,
+	pbkdf2.SHA512: 64,
+	pbkdf2.MD5:    16,
+}
+
+// Hash creates a Werkzeug-formatted hash with config provided
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/werkzeug"
+//	)
+//
+//	func main() {
+//	  hash, err := werkzeug.Hash("password", werkzeug.Config{Method: werkzeug.PBKDF2})
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(hash) // pbkdf2:sha256:600000$Xq3cLk7ZpR2mNvB8$e60dbed716c2...
+//	}
+func Hash(plain string, config Config) (string, error) {
+	if plain == "" {
+		return "", ErrEmptyField
+	}
+
+	config = applyDefaults(config)
+
+	var method, hash string
+	var err error
+	switch config.Method {
+	case PBKDF2:
+		hashFunc, ok := hashFuncs[config.HashName]
+		if !ok {
+			return "", ErrHashNotSupported
+		}
+		config.PBKDF2.HashFunc = hashFunc
+		config.PBKDF2.KeyLen = digestSizes[hashFunc]
+		method = fmt.Sprintf("%s:%s:%d", PBKDF2, config.HashName, config.PBKDF2.Rounds)
+		hash, err = pbkdf2.Hash(plain, config.PBKDF2)
+	case Scrypt:
+		method = fmt.Sprintf("%s:%d:%d:%d", Scrypt, config.Scrypt.Cost, config.Scrypt.Rounds, config.Scrypt.Parallelism)
+		hash, err = scrypt.Hash(plain, config.Scrypt)
+	default:
+		return "", ErrMethodNotSupported
+	}
+	if err != nil {
+		return "", err
+	}
+
+	deserialize, err := format.Deserialize(hash)
+	if err != nil {
+		return "", err
+	}
+	return method + "$" + string(deserialize.Salt) + "$" + hex.EncodeToString(deserialize.Hash), nil
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/werkzeug"
+//	)
+//
+//	func main() {
+//	  hash := "pbkdf2:sha256:1000$Xq3cLk7ZpR2mNvB8$e60dbed716c2187891798c5472530d30587d2a4f0e84b4312af4ee71d64e00ad"
+//
+//	  verify, err := werkzeug.Verify(hash, "password123")
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(verify) // true
+//	}
+func Verify(hash string, plain string) (bool, error) {
+	return Config{}.Verify(hash, plain)
+}
+
+// NeedsRehash checks whether the hash was created with another method than the config provided,
+// or whether the algorithm package reports it as weaker than the config.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/werkzeug"
+//	)
+//
+//	func main() {
+//	  hash := "pbkdf2:sha256:1000$Xq3cLk7ZpR2mNvB8$e60dbed716c2187891798c5472530d30587d2a4f0e84b4312af4ee71d64e00ad"
+//
+//	  rehash, err := werkzeug.NeedsRehash(hash, werkzeug.Config{Method: werkzeug.PBKDF2})
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(rehash) // true
+//	}
+func NeedsRehash(hash string, config Config) (bool, error) {
+	if hash == "" {
+		return false, ErrEmptyField
+	}
+
+	method, converted, err := convert(hash)
+	if err != nil {
+		return false, err
+	}
+
+	config = applyDefaults(config)
+
+	if method != config.Method {
+		return true, nil
+	}
+
+	if method == PBKDF2 {
+		hashFunc, ok := hashFuncs[config.HashName]
+		if !ok {
+			return false, ErrHashNotSupported
+		}
+		config.PBKDF2.HashFunc = hashFunc
+		config.PBKDF2.KeyLen = digestSizes[hashFunc]
+		return pbkdf2.NeedsRehash(converted, config.PBKDF2)
+	}
+	return scrypt.NeedsRehash(converted, config.Scrypt)
+}
+
+// convert reads the method of a Werkzeug hash, and converts the hash to the format
+// of its algorithm package. Parameters missing from the method take the defaults of Werkzeug.
+func convert(hash string) (Method, string, error) {
+	fields := strings.SplitN(hash, "$", 3)
+	if len(fields) != 3 {
+		return "", "", fmt.Errorf("%w: hash must be formatted as method$salt$hash", format.ErrInvalidFormat)
+	}
+	if fields[1] == "" {
+		return "", "", fmt.Errorf("%w: salt", format.ErrEmptyValue)
+	}
+	checksum, err := hex.DecodeString(fields[2])
+	if err != nil || len(checksum) == 0 {
+		return "", "", fmt.Errorf("%w: hash must be hex-encoded", format.ErrInvalidFormat)
+	}
+
+	args := strings.Split(fields[0], ":")
+	method := Method(args[0])
+	switch method {
+	case PBKDF2:
+		if len(args) > 3 {
+			return "", "", fmt.Errorf("%w: too many pbkdf2 arguments", format.ErrInvalidFormat)
+		}
+		name, rounds := "sha256", strconv.Itoa(PBKDF2_ROUNDS)
+		if len(args) > 1 {
+			name = args[1]
+		}
+		if len(args) > 2 {
+			rounds = args[2]
+		}
+		if _, ok := hashFuncs[name]; !ok {
+			return "", "", fmt.Errorf("%w: %q", ErrHashNotSupported, name)
+		}
+		return method, format.Serialize(format.PHCConfig{
+			ID:            "pbkdf2" + name,
+			OrderedParams: []format.Param{{Name: "i", Value: rounds}},
+			Salt:          []byte(fields[1]),
+			Hash:          checksum,
+		}), nil
+	case Scrypt:
+		if len(args) > 4 {
+			return "", "", fmt.Errorf("%w: too many scrypt arguments", format.ErrInvalidFormat)
+		}
+		params := []string{strconv.Itoa(SCRYPT_COST), "8", "1"}
+		copy(params, args[1:])
+		cost, err := strconv.ParseUint(params[0], 10, 64)
+		if err != nil || cost < 2 || cost&(cost-1) != 0 {
+			return "", "", fmt.Errorf("%w: N must be a power of 2 greater than 1", format.ErrInvalidParam)
+		}
+		return method, format.Serialize(format.PHCConfig{
+			ID:          "scrypt",
+			OmitVersion: true,
+			OrderedParams: []format.Param{
+				{Name: "ln", Value: bits.TrailingZeros64(cost)},
+				{Name: "r", Value: params[1]},
+				{Name: "p", Value: params[2]},
+			},
+			Salt: []byte(fields[1]),
+			Hash: checksum,
+		}), nil
+	default:
+		return "", "", ErrMethodNotSupported
+	}
+}
+
+// applyDefaults fills the empty fields of config with the defaults of Werkzeug.
+func applyDefaults(config Config) Config {
+	if config.Method == "" {
+		config.Method = Scrypt
+	}
+	if config.HashName == "" {
+		config.HashName = "sha256"
+	}
+
+	if config.PBKDF2.Rounds <= 0 {
+		config.PBKDF2.Rounds = PBKDF2_ROUNDS
+	}
+	if config.PBKDF2.SaltLen <= 0 {
+		config.PBKDF2.SaltLen = SALT_LENGTH
+	}
+	if config.PBKDF2.Rand == nil {
+		config.PBKDF2.Rand = salt.Reader(saltChars)
+	}
+	config.PBKDF2.Dialect = pbkdf2.PHC
+
+	if config.Scrypt.Cost <= 0 {
+		config.Scrypt.Cost = SCRYPT_COST
+	}
+	if config.Scrypt.Rounds <= 0 {
+		config.Scrypt.Rounds = 8
+	}
+	if config.Scrypt.Parallelism <= 0 {
+		config.Scrypt.Parallelism = 1
+	}
+	if config.Scrypt.SaltLen <= 0 {
+		config.Scrypt.SaltLen = SALT_LENGTH
+	}
+	if config.Scrypt.Rand == nil {
+		config.Scrypt.Rand = salt.Reader(saltChars)
+	}
+	config.Scrypt.KeyLen = SCRYPT_KEYLEN
+	return config
+}
+
+// Hash creates a Werkzeug-formatted hash with the config. See the package-level Hash function.
+func (c Config) Hash(plain string) (string, error) {
+	return Hash(plain, c)
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided,
+// using the Limits of the algorithm configs. See the package-level Verify function.
+func (c Config) Verify(hash, plain string) (bool, error) {
+	if hash == "" || plain == "" {
+		return false, ErrEmptyField
+	}
+
+	method, converted, err := convert(hash)
+	if err != nil {
+		return false, err
+	}
+
+	if method == PBKDF2 {
+		return c.PBKDF2.Verify(converted, plain)
+	}
+	return c.Scrypt.Verify(converted, plain)
+}
+
+// NeedsRehash checks whether the hash is weaker than the config. See the package-level NeedsRehash function.
+func (c Config) NeedsRehash(hash string) (bool, error) {
+	return NeedsRehash(hash, c)
+}
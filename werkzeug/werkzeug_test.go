@@ -0,0 +1,179 @@
+package werkzeug_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/pbkdf2"
+	"github.com/aldy505/phc-crypto/scrypt"
+	"github.com/aldy505/phc-crypto/werkzeug"
+)
+
+// config keeps the costs low, so that the tests run fast.
+var config = werkzeug.Config{
+	PBKDF2: pbkdf2.Config{Rounds: 1000},
+	Scrypt: scrypt.Config{Cost: 1024},
+}
+
+func TestHash(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config werkzeug.Config
+		method string
+		keyLen int
+	}{
+		{"scrypt", werkzeug.Config{Method: werkzeug.Scrypt}, "scrypt:1024:8:1", 64},
+		{"pbkdf2", werkzeug.Config{Method: werkzeug.PBKDF2}, "pbkdf2:sha256:1000", 32},
+		{"pbkdf2 sha512", werkzeug.Config{Method: werkzeug.PBKDF2, HashName: "sha512"}, "pbkdf2:sha512:1000", 64},
+		{"pbkdf2 sha1", werkzeug.Config{Method: werkzeug.PBKDF2, HashName: "sha1"}, "pbkdf2:sha1:1000", 20},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := config
+			c.Method = tc.config.Method
+			c.HashName = tc.config.HashName
+			hash, err := werkzeug.Hash("password123", c)
+			if err != nil {
+				t.Error(err)
+			}
+			segments := strings.Split(hash, "$")
+			if len(segments) != 3 || segments[0] != tc.method || len(segments[1]) != werkzeug.SALT_LENGTH || len(segments[2]) != tc.keyLen*2 {
+				t.Error("unexpected encoding:", hash)
+			}
+			if strings.Trim(segments[1], "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789") != "" {
+				t.Error("unexpected salt:", segments[1])
+			}
+
+			verify, err := werkzeug.Verify(hash, "password123")
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false")
+			}
+
+			rehash, err := werkzeug.NeedsRehash(hash, c)
+			if err != nil {
+				t.Error(err)
+			}
+			if rehash {
+				t.Error("needs rehash function returned true")
+			}
+		})
+	}
+
+	t.Run("should return error if plain is empty", func(t *testing.T) {
+		if _, err := werkzeug.Hash("", config); !errors.Is(err, werkzeug.ErrEmptyField) {
+			t.Error("expected ErrEmptyField, got:", err)
+		}
+	})
+
+	t.Run("should return error for unknown methods and hash functions", func(t *testing.T) {
+		if _, err := werkzeug.Hash("password123", werkzeug.Config{Method: "plain"}); !errors.Is(err, werkzeug.ErrMethodNotSupported) {
+			t.Error("expected ErrMethodNotSupported, got:", err)
+		}
+		if _, err := werkzeug.Hash("password123", werkzeug.Config{Method: werkzeug.PBKDF2, HashName: "whirlpool"}); !errors.Is(err, werkzeug.ErrHashNotSupported) {
+			t.Error("expected ErrHashNotSupported, got:", err)
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	testCases := []struct {
+		name string
+		hash string
+	}{
+		{"pbkdf2 sha256", "pbkdf2:sha256:1000$Xq3cLk7ZpR2mNvB8$e60dbed716c2187891798c5472530d30587d2a4f0e84b4312af4ee71d64e00ad"},
+		{"pbkdf2 sha512", "pbkdf2:sha512:1000$Xq3cLk7ZpR2mNvB8$efddcacbab48f109ab24524ed647242e1366b24746a4c498ce234ffc35ad78d474eb95a86156715eb1ba79d875f8c0acfd433db4b60f76ab365cdc65bbbc5dab"},
+		{"pbkdf2 sha1", "pbkdf2:sha1:1000$Xq3cLk7ZpR2mNvB8$61b5bbc4c93f765e861c944208b8310f45a1b641"},
+		{"scrypt", "scrypt:1024:8:1$Xq3cLk7ZpR2mNvB8$2c2e9591605ac781cde7f6a668d6195a14a33cb149bf3586677d3f93027a5e803833167ed961be70c7cd8445d818533ab97429d9ef101dbc86febf417b38248e"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			verify, err := werkzeug.Verify(tc.hash, "password123")
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false")
+			}
+
+			verify, err = werkzeug.Verify(tc.hash, "password")
+			if err != nil {
+				t.Error(err)
+			}
+			if verify {
+				t.Error("verify function returned true")
+			}
+		})
+	}
+
+	t.Run("should apply the limits of the algorithm configs", func(t *testing.T) {
+		c := werkzeug.Config{Scrypt: scrypt.Config{Limits: scrypt.Limits{MaxCost: 512}}}
+		_, err := c.Verify(testCases[3].hash, "password123")
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("expected ErrLimitExceeded, got:", err)
+		}
+	})
+
+	t.Run("should reject malformed hashes", func(t *testing.T) {
+		malformed := []struct {
+			hash string
+			err  error
+		}{
+			{"", werkzeug.ErrEmptyField},
+			{"pbkdf2:sha256:1000$Xq3cLk7ZpR2mNvB8", format.ErrInvalidFormat},
+			{"pbkdf2:sha256:1000$$61b5", format.ErrEmptyValue},
+			{"pbkdf2:sha256:1000$Xq3cLk7ZpR2mNvB8$zz", format.ErrInvalidFormat},
+			{"pbkdf2:sha256:1000:1$Xq3cLk7ZpR2mNvB8$61b5", format.ErrInvalidFormat},
+			{"pbkdf2:whirlpool:1000$Xq3cLk7ZpR2mNvB8$61b5", werkzeug.ErrHashNotSupported},
+			{"pbkdf2:sha256:abc$Xq3cLk7ZpR2mNvB8$61b5", format.ErrInvalidParam},
+			{"scrypt:1000:8:1$Xq3cLk7ZpR2mNvB8$61b5", format.ErrInvalidParam},
+			{"plain$Xq3cLk7ZpR2mNvB8$61b5", werkzeug.ErrMethodNotSupported},
+		}
+
+		for _, tc := range malformed {
+			if _, err := werkzeug.Verify(tc.hash, "password123"); !errors.Is(err, tc.err) {
+				t.Errorf("%q: expected %v, got: %v", tc.hash, tc.err, err)
+			}
+		}
+	})
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hash := "pbkdf2:sha256:1000$Xq3cLk7ZpR2mNvB8$e60dbed716c2187891798c5472530d30587d2a4f0e84b4312af4ee71d64e00ad"
+
+	t.Run("should need rehash for another method", func(t *testing.T) {
+		rehash, err := werkzeug.NeedsRehash(hash, werkzeug.Config{})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should need rehash for another hash function", func(t *testing.T) {
+		rehash, err := werkzeug.NeedsRehash(hash, werkzeug.Config{Method: werkzeug.PBKDF2, HashName: "sha512", PBKDF2: pbkdf2.Config{Rounds: 1000}})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should need rehash for weaker parameters", func(t *testing.T) {
+		rehash, err := werkzeug.NeedsRehash(hash, werkzeug.Config{Method: werkzeug.PBKDF2})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+}
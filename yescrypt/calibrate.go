@@ -0,0 +1,84 @@
+package yescrypt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/internal/calibrate"
+)
+
+// minCalibratedCost is the least block count that Calibrate returns, as the RW mode needs N to be above 3.
+const minCalibratedCost = 4
+
+// Calibrate benchmarks yescrypt on the host and returns a Config whose hashes take about
+// target to be created, with up to memoryBudget bytes of memory per hash (128 * N * r).
+// The cost (N) is set to the largest power of 2 that fits in the budget, and halved while
+// a hash takes longer than target. The time factor is then raised to fill the target,
+// as it adds time without adding memory. The parameters never exceed DefaultLimits,
+// so the hashes are accepted by Verify.
+//
+// Calibrate hashes several times, so it takes a few times the target to return.
+//
+//	import (
+//	  "fmt"
+//	  "time"
+//	  "github.com/aldy505/phc-crypto/yescrypt"
+//	)
+//
+//	func main() {
+//	  config, err := yescrypt.Calibrate(500*time.Millisecond, 64<<20)
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(config.Cost, config.Time) // 16384 2, depending on the host
+//	}
+func Calibrate(target time.Duration, memoryBudget int) (Config, error) {
+	if err := calibrate.CheckTarget(target); err != nil {
+		return Config{}, err
+	}
+
+	config := Config{
+		Cost:        minCalibratedCost,
+		Rounds:      ROUNDS,
+		Parallelism: PARALLELISM,
+	}
+	budget := min(memoryBudget, DefaultLimits.MaxMemory)
+	if 128*config.Cost*config.Rounds > budget {
+		return Config{}, fmt.Errorf("%w: memory budget must be at least %d bytes", format.ErrInvalidParam, 128*config.Cost*config.Rounds)
+	}
+	for 128*config.Cost*2*config.Rounds <= budget && config.Cost*2 <= DefaultLimits.MaxCost {
+		config.Cost *= 2
+	}
+
+	elapsed, err := measure(config)
+	if err != nil {
+		return Config{}, err
+	}
+	for elapsed > target && config.Cost > minCalibratedCost {
+		config.Cost /= 2
+		if elapsed, err = measure(config); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for config.Time < DefaultLimits.MaxTime && elapsed*time.Duration(work(config.Time+1)) <= target*time.Duration(work(0)) {
+		config.Time++
+	}
+	return config, nil
+}
+
+// work returns the work of the RW mode with the time factor t, in thirds of the work of
+// a pass over the N blocks: the first pass is followed by a third of a pass with t=0,
+// two thirds with t=1, and by t-1 passes above that.
+func work(t int) int {
+	return max(4+t, 3*t)
+}
+
+// measure returns the duration of a hash with config.
+func measure(config Config) (time.Duration, error) {
+	return calibrate.Measure(func() error {
+		_, err := Hash("password", config)
+		return err
+	})
+}
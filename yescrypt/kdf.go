@@ -0,0 +1,360 @@
+package yescrypt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The pwxform settings of the RW mode, as used by libxcrypt (YESCRYPT_ROUNDS_6,
+// YESCRYPT_GATHER_4, YESCRYPT_SIMPLE_2 and YESCRYPT_SBOX_12K).
+const (
+	pwxSimple = 2
+	pwxGather = 4
+	pwxRounds = 6
+	sWidth    = 8
+
+	// pwxWords is the size of a pwxform block in 32-bit words, the same as a Salsa20 block.
+	pwxWords = pwxGather * pwxSimple * 2
+	// sBytes is the size of the S-boxes of one thread.
+	sBytes = 3 * (1 << sWidth) * pwxSimple * 8
+	sWords = sBytes / 4
+	// sMask masks the byte offset of a S-box lookup.
+	sMask = ((1 << sWidth) - 1) * pwxSimple * 8
+	// wMask masks the byte offset of the S-box write pointer.
+	wMask = (1<<sWidth)*pwxSimple*8 - 1
+)
+
+// pwxformCtx holds the S-boxes of one thread and their rotation.
+// S0, S1 and S2 are offsets in words into S, and w is the write offset in bytes into S2.
+type pwxformCtx struct {
+	S          []uint32
+	S0, S1, S2 int
+	w          int
+}
+
+// key derives the 32-byte hash of the yescrypt crypt(3) scheme. When the RW mode uses
+// a lot of memory, the password is first pre-hashed with 1/64 of it.
+func key(password, salt []byte, flags Flags, n uint64, r, p, t uint32) []byte {
+	if flags == RW && n/uint64(p) >= 0x100 && n/uint64(p)*uint64(r) >= 0x20000 {
+		password = kdfBody(password, salt, flags, true, n>>6, r, p, 0)
+	}
+	return kdfBody(password, salt, flags, false, n, r, p, t)
+}
+
+// kdfBody is yescrypt_kdf_body of the reference implementation, always creating 32 bytes.
+// Without flags, it's scrypt.
+func kdfBody(password, salt []byte, flags Flags, prehash bool, n uint64, r, p, t uint32) []byte {
+	if flags != 0 {
+		hmacKey := "yescrypt"
+		if prehash {
+			hmacKey = "yescrypt-prehash"
+		}
+		mac := hmac.New(sha256.New, []byte(hmacKey))
+		mac.Write(password)
+		password = mac.Sum(nil)
+	}
+
+	s := 32 * int(r)
+	b := pbkdf2.Key(password, salt, 1, int(p)*4*s, sha256.New)
+	if flags != 0 {
+		// the first bytes of B are the password of the final PBKDF2 from now on
+		password = append(password[:0], b[:32]...)
+	}
+
+	words := make([]uint32, int(p)*s)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+
+	v := make([]uint32, uint64(s)*n)
+	if flags == RW || p == 1 {
+		smix(words, int(r), n, p, t, flags, v, password)
+	} else {
+		for i := 0; i < int(p); i++ {
+			smix(words[i*s:(i+1)*s], int(r), n, 1, t, flags, v, nil)
+		}
+	}
+
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(b[i*4:], w)
+	}
+	dk := pbkdf2.Key(password, b, 1, 32, sha256.New)
+
+	// the final steps match those of SCRAM (RFC 5802), computing the StoredKey
+	if flags != 0 && !prehash {
+		mac := hmac.New(sha256.New, dk)
+		mac.Write([]byte("Client Key"))
+		storedKey := sha256.Sum256(mac.Sum(nil))
+		dk = storedKey[:]
+	}
+	return dk
+}
+
+// smix computes B = SMix(B) for the p blocks of B. In the RW mode, the 32 bytes of
+// password are replaced with their HMAC keyed by the first block.
+func smix(b []uint32, r int, n uint64, p, t uint32, flags Flags, v []uint32, password []byte) {
+	s := 32 * r
+
+	nchunk := n / uint64(p)
+	nloopAll := nchunk
+	if flags == RW {
+		if t <= 1 {
+			if t == 1 {
+				nloopAll *= 2
+			}
+			nloopAll = (nloopAll + 2) / 3
+		} else {
+			nloopAll *= uint64(t) - 1
+		}
+	} else if t != 0 {
+		if t == 1 {
+			nloopAll += (nloopAll + 1) / 2
+		}
+		nloopAll *= uint64(t)
+	}
+
+	var nloopRW uint64
+	if flags == RW {
+		nloopRW = nloopAll / uint64(p)
+	}
+
+	nchunk &^= 1
+	nloopAll = (nloopAll + 1) &^ 1
+	nloopRW = (nloopRW + 1) &^ 1
+
+	ctxs := make([]*pwxformCtx, p)
+	xy := make([]uint32, 2*s)
+	var vchunk uint64
+	for i := 0; i < int(p); i++ {
+		np := nchunk
+		if i == int(p)-1 {
+			np = n - vchunk
+		}
+		bp := b[i*s : (i+1)*s]
+		vp := v[vchunk*uint64(s):]
+
+		if flags == RW {
+			sbox := make([]uint32, sWords)
+			smix1(bp[:32], 1, sBytes/128, false, sbox, nil, xy)
+			ctxs[i] = &pwxformCtx{S: sbox, S2: 0, S1: sWords / 3, S0: sWords / 3 * 2}
+			if i == 0 {
+				last := make([]byte, 64)
+				for k, w := range bp[s-16:] {
+					binary.LittleEndian.PutUint32(last[k*4:], w)
+				}
+				mac := hmac.New(sha256.New, last)
+				mac.Write(password)
+				copy(password, mac.Sum(nil))
+			}
+		}
+
+		smix1(bp, r, np, flags == RW, vp, ctxs[i], xy)
+		smix2(bp, r, p2floor(np), nloopRW, flags == RW, vp, ctxs[i], xy)
+		vchunk += nchunk
+	}
+
+	for i := 0; i < int(p); i++ {
+		smix2(b[i*s:(i+1)*s], r, n, nloopAll-nloopRW, false, v, ctxs[i], xy)
+	}
+}
+
+// smix1 is the first loop of SMix, filling V. The words of X are shuffled the same way
+// as the reference implementation, since pwxform and the S-boxes depend on their order.
+func smix1(b []uint32, r int, n uint64, rw bool, v []uint32, ctx *pwxformCtx, xy []uint32) {
+	s := 32 * r
+	x, y := xy[:s], xy[s:2*s]
+
+	for k := 0; k < 2*r; k++ {
+		for i := 0; i < 16; i++ {
+			x[k*16+i] = b[k*16+i*5%16]
+		}
+	}
+
+	for i := uint64(0); i < n; i++ {
+		copy(v[i*uint64(s):], x)
+		if rw && i > 1 {
+			j := wrap(integerify(x, r), i)
+			xor(x, v[j*uint64(s):])
+		}
+		blockmix(x, y, r, ctx)
+	}
+
+	for k := 0; k < 2*r; k++ {
+		for i := 0; i < 16; i++ {
+			b[k*16+i*5%16] = x[k*16+i]
+		}
+	}
+}
+
+// smix2 is the second loop of SMix, reading V and, in the RW mode, writing it back.
+func smix2(b []uint32, r int, n, nloop uint64, rw bool, v []uint32, ctx *pwxformCtx, xy []uint32) {
+	if nloop == 0 {
+		return
+	}
+
+	s := 32 * r
+	x, y := xy[:s], xy[s:2*s]
+
+	for k := 0; k < 2*r; k++ {
+		for i := 0; i < 16; i++ {
+			x[k*16+i] = b[k*16+i*5%16]
+		}
+	}
+
+	for i := uint64(0); i < nloop; i++ {
+		j := integerify(x, r) & (n - 1)
+		vj := v[j*uint64(s) : (j+1)*uint64(s)]
+		xor(x, vj)
+		if rw {
+			copy(vj, x)
+		}
+		blockmix(x, y, r, ctx)
+	}
+
+	for k := 0; k < 2*r; k++ {
+		for i := 0; i < 16; i++ {
+			b[k*16+i*5%16] = x[k*16+i]
+		}
+	}
+}
+
+// blockmix is BlockMix_pwxform in the RW mode, and BlockMix_salsa20/8 of scrypt otherwise.
+func blockmix(b, y []uint32, r int, ctx *pwxformCtx) {
+	if ctx == nil {
+		blockmixSalsa8(b, y, r)
+		return
+	}
+
+	var x [pwxWords]uint32
+	r1 := 2 * r
+	copy(x[:], b[(r1-1)*pwxWords:])
+	for i := 0; i < r1; i++ {
+		if r1 > 1 {
+			xor(x[:], b[i*pwxWords:])
+		}
+		pwxform(x[:], ctx)
+		copy(b[i*pwxWords:], x[:])
+	}
+	salsa20(b[(r1-1)*16:r1*16], 2)
+}
+
+// blockmixSalsa8 is the BlockMix of scrypt.
+func blockmixSalsa8(b, y []uint32, r int) {
+	var x [16]uint32
+	copy(x[:], b[(2*r-1)*16:])
+	for i := 0; i < 2*r; i++ {
+		xor(x[:], b[i*16:])
+		salsa20(x[:], 8)
+		copy(y[i*16:], x[:])
+	}
+	for i := 0; i < r; i++ {
+		copy(b[i*16:(i+1)*16], y[2*i*16:])
+		copy(b[(i+r)*16:(i+r+1)*16], y[(2*i+1)*16:])
+	}
+}
+
+// pwxform transforms a block with multiplications and S-box lookups, writing to the S-boxes on the way.
+func pwxform(x []uint32, ctx *pwxformCtx) {
+	sbox := ctx.S
+	for i := 0; i < pwxRounds; i++ {
+		for j := 0; j < pwxGather; j++ {
+			p0 := ctx.S0 + int(x[j*4]&sMask)/4
+			p1 := ctx.S1 + int(x[j*4+1]&sMask)/4
+			for k := 0; k < pwxSimple; k++ {
+				s0 := uint64(sbox[p0+2*k+1])<<32 | uint64(sbox[p0+2*k])
+				s1 := uint64(sbox[p1+2*k+1])<<32 | uint64(sbox[p1+2*k])
+				lo, hi := x[j*4+2*k], x[j*4+2*k+1]
+				v := (uint64(hi)*uint64(lo) + s0) ^ s1
+				x[j*4+2*k], x[j*4+2*k+1] = uint32(v), uint32(v>>32)
+			}
+			if i != 0 && i != pwxRounds-1 {
+				for k := 0; k < pwxSimple; k++ {
+					sbox[ctx.S2+ctx.w/4] = x[j*4+2*k]
+					sbox[ctx.S2+ctx.w/4+1] = x[j*4+2*k+1]
+					ctx.w += 8
+				}
+			}
+		}
+	}
+	ctx.S0, ctx.S1, ctx.S2 = ctx.S2, ctx.S0, ctx.S1
+	ctx.w &= wMask
+}
+
+// salsa20 applies the Salsa20 core with the given rounds to a shuffled block.
+func salsa20(b []uint32, rounds int) {
+	var x [16]uint32
+	for i := 0; i < 16; i++ {
+		x[i*5%16] = b[i]
+	}
+
+	for i := 0; i < rounds; i += 2 {
+		x[4] ^= bits.RotateLeft32(x[0]+x[12], 7)
+		x[8] ^= bits.RotateLeft32(x[4]+x[0], 9)
+		x[12] ^= bits.RotateLeft32(x[8]+x[4], 13)
+		x[0] ^= bits.RotateLeft32(x[12]+x[8], 18)
+		x[9] ^= bits.RotateLeft32(x[5]+x[1], 7)
+		x[13] ^= bits.RotateLeft32(x[9]+x[5], 9)
+		x[1] ^= bits.RotateLeft32(x[13]+x[9], 13)
+		x[5] ^= bits.RotateLeft32(x[1]+x[13], 18)
+		x[14] ^= bits.RotateLeft32(x[10]+x[6], 7)
+		x[2] ^= bits.RotateLeft32(x[14]+x[10], 9)
+		x[6] ^= bits.RotateLeft32(x[2]+x[14], 13)
+		x[10] ^= bits.RotateLeft32(x[6]+x[2], 18)
+		x[3] ^= bits.RotateLeft32(x[15]+x[11], 7)
+		x[7] ^= bits.RotateLeft32(x[3]+x[15], 9)
+		x[11] ^= bits.RotateLeft32(x[7]+x[3], 13)
+		x[15] ^= bits.RotateLeft32(x[11]+x[7], 18)
+
+		x[1] ^= bits.RotateLeft32(x[0]+x[3], 7)
+		x[2] ^= bits.RotateLeft32(x[1]+x[0], 9)
+		x[3] ^= bits.RotateLeft32(x[2]+x[1], 13)
+		x[0] ^= bits.RotateLeft32(x[3]+x[2], 18)
+		x[6] ^= bits.RotateLeft32(x[5]+x[4], 7)
+		x[7] ^= bits.RotateLeft32(x[6]+x[5], 9)
+		x[4] ^= bits.RotateLeft32(x[7]+x[6], 13)
+		x[5] ^= bits.RotateLeft32(x[4]+x[7], 18)
+		x[11] ^= bits.RotateLeft32(x[10]+x[9], 7)
+		x[8] ^= bits.RotateLeft32(x[11]+x[10], 9)
+		x[9] ^= bits.RotateLeft32(x[8]+x[11], 13)
+		x[10] ^= bits.RotateLeft32(x[9]+x[8], 18)
+		x[12] ^= bits.RotateLeft32(x[15]+x[14], 7)
+		x[13] ^= bits.RotateLeft32(x[12]+x[15], 9)
+		x[14] ^= bits.RotateLeft32(x[13]+x[12], 13)
+		x[15] ^= bits.RotateLeft32(x[14]+x[13], 18)
+	}
+
+	for i := 0; i < 16; i++ {
+		b[i] += x[i*5%16]
+	}
+}
+
+// integerify reads the 64-bit integer of the last 64-byte block of a shuffled block,
+// which is made of the words 0 and 1 before shuffling.
+func integerify(x []uint32, r int) uint64 {
+	last := x[(2*r-1)*16:]
+	return uint64(last[13])<<32 | uint64(last[0])
+}
+
+// wrap maps x to the range of the blocks of V written before block i.
+func wrap(x, i uint64) uint64 {
+	n := p2floor(i)
+	return (x & (n - 1)) + (i - n)
+}
+
+// p2floor returns the largest power of 2 not greater than x.
+func p2floor(x uint64) uint64 {
+	if x == 0 {
+		return 0
+	}
+	return 1 << (bits.Len64(x) - 1)
+}
+
+func xor(dst, src []uint32) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
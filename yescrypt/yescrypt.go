@@ -0,0 +1,550 @@
+// Package yescrypt implements yescrypt, the $y$ scheme that Debian, Fedora and Ubuntu
+// use by default in /etc/shadow. yescrypt builds on the ROMix core of scrypt, and
+// the hashes are compatible with the ones of libxcrypt.
+package yescrypt
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/aldy505/phc-crypto/format"
+)
+
+// Config initialize the config require to create a hash function
+type Config struct {
+	// Cost is the block count (N), a power of 2.
+	Cost int
+	// Rounds is the block size (r).
+	Rounds int
+	// Parallelism is the parallelism factor (p).
+	Parallelism int
+	// Time is the additional time factor (t), increasing the running time without more memory.
+	Time int
+	// Flags is the mode of yescrypt, RW when empty.
+	Flags   Flags
+	SaltLen int
+	// Limits caps the parameters of the hashes accepted by Verify.
+	// Empty fields fall back to DefaultLimits.
+	Limits Limits
+}
+
+// Limits caps the parameters that Verify accepts from a hash, so that a hash with
+// a hostile cost can't exhaust the memory or the CPU of the verifier.
+// The check is done before any hashing work starts, and a hash that exceeds
+// any of the limits is rejected with format.ErrLimitExceeded.
+type Limits struct {
+	// MaxCost is the maximum block count (N)
+	MaxCost int
+	// MaxMemory is the maximum amount of memory in bytes, computed as 128 * N * r
+	MaxMemory int
+	// MaxParallelism is the maximum parallelism factor (p)
+	MaxParallelism int
+	// MaxTime is the maximum time factor (t)
+	MaxTime int
+}
+
+// DefaultLimits are the limits used by Verify, and by Config.Verify for the empty fields of Config.Limits.
+var DefaultLimits = Limits{
+	MaxCost:        1 << 20,
+	MaxMemory:      1 << 30,
+	MaxParallelism: 16,
+	MaxTime:        8,
+}
+
+// Flags sets up enum for the available modes of yescrypt.
+type Flags uint32
+
+const (
+	// Scrypt points to the classic scrypt mode, which can only be verified,
+	// as an empty Flags stands for RW
+	Scrypt Flags = 0
+	// WORM points to the write-once, read-many mode
+	WORM Flags = 1
+	// RW points to the read-write mode with the pwxform settings of libxcrypt, its default
+	RW Flags = 0xb6
+)
+
+const (
+	// COST is the block count (N), the default of libxcrypt.
+	COST = 4096
+	// ROUNDS is the block size (r), the default of libxcrypt.
+	ROUNDS = 32
+	// PARALLELISM is the parallelism factor (p).
+	PARALLELISM = 1
+	// SALT_LENGTH is the default salt length in bytes.
+	SALT_LENGTH = 16
+)
+
+var ErrEmptyField error = errors.New("function parameters must not be empty")
+var ErrInvalidFlags error = errors.New("invalid yescrypt flags")
+
+// cryptAlphabet is the base64 alphabet of crypt(3), in which the parameters, the salt and the hash are encoded.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const (
+	// modeRW is the mode bit of RW, below the pwxform settings in the flags.
+	modeRW = 2
+	// rwFlavorMask is the mask of the pwxform settings of the RW mode in the flags.
+	rwFlavorMask = 0x3fc
+	// maxSaltLength is the maximum length of the salt in bytes.
+	maxSaltLength = 64
+)
+
+// params are the parameters of a yescrypt hash.
+type params struct {
+	flags Flags
+	n     uint64
+	r     uint32
+	p     uint32
+	t     uint32
+}
+
+// Hash creates a yescrypt hash with config provided, formatted as $y$<params>$<salt>$<hash>.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/yescrypt"
+//	)
+//
+//	func main() {
+//	  hash, err := yescrypt.Hash("password", yescrypt.Config{})
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(hash) // $y$j9T$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r/L0zki0Fm7nl7yeDuySShwVAOWtG65Jkd2XA
+//	}
+func Hash(plain string, config Config) (string, error) {
+	if plain == "" {
+		return "", ErrEmptyField
+	}
+
+	config = applyDefaults(config)
+
+	p := params{
+		flags: config.Flags,
+		n:     uint64(config.Cost),
+		r:     uint32(config.Rounds),
+		p:     uint32(config.Parallelism),
+		t:     uint32(config.Time),
+	}
+	if err := checkParams(p); err != nil {
+		return "", err
+	}
+	if config.SaltLen > maxSaltLength {
+		return "", fmt.Errorf("%w: salt length must be at most %d", format.ErrInvalidParam, maxSaltLength)
+	}
+
+	salt := make([]byte, config.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	hash := key([]byte(plain), salt, p.flags, p.n, p.r, p.p, p.t)
+	return "$y$" + encodeParams(p) + "$" + encode64(salt) + "$" + encode64(hash), nil
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/yescrypt"
+//	)
+//
+//	func main() {
+//	  hash := "$y$j9T$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r/L0zki0Fm7nl7yeDuySShwVAOWtG65Jkd2XA"
+//
+//	  verify, err := yescrypt.Verify(hash, "password123")
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(verify) // true
+//	}
+func Verify(hash string, plain string) (bool, error) {
+	return Config{}.Verify(hash, plain)
+}
+
+// NeedsRehash checks whether the hash was created with other flags or with weaker
+// parameters (cost, rounds, parallelism, time or salt length) than the config provided.
+//
+//	import (
+//	  "fmt"
+//	  "github.com/aldy505/phc-crypto/yescrypt"
+//	)
+//
+//	func main() {
+//	  hash := "$y$j9T$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r/L0zki0Fm7nl7yeDuySShwVAOWtG65Jkd2XA"
+//
+//	  rehash, err := yescrypt.NeedsRehash(hash, yescrypt.Config{Cost: 8192})
+//	  if err != nil {
+//	    fmt.Println(err)
+//	  }
+//	  fmt.Println(rehash) // true
+//	}
+func NeedsRehash(hash string, config Config) (bool, error) {
+	if hash == "" {
+		return false, ErrEmptyField
+	}
+
+	p, salt, _, err := parseHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	config = applyDefaults(config)
+
+	return p.flags != config.Flags ||
+		p.n < uint64(config.Cost) ||
+		uint64(p.r) < uint64(config.Rounds) ||
+		uint64(p.p) < uint64(config.Parallelism) ||
+		uint64(p.t) < uint64(config.Time) ||
+		len(salt) < config.SaltLen, nil
+}
+
+// parseHash reads the parameters, the salt and the hash of a yescrypt hash.
+func parseHash(hash string) (p params, salt, checksum []byte, err error) {
+	fields := strings.Split(hash, "$")
+	if len(fields) != 5 || fields[0] != "" || fields[1] != "y" {
+		err = fmt.Errorf("%w: hash must be formatted as $y$<params>$<salt>$<hash>", format.ErrInvalidFormat)
+		return
+	}
+
+	p, err = decodeParams(fields[2])
+	if err != nil {
+		return
+	}
+	if err = checkParams(p); err != nil {
+		return
+	}
+
+	salt, ok := decode64(fields[3])
+	if !ok || len(salt) > maxSaltLength {
+		err = fmt.Errorf("%w: invalid salt", format.ErrInvalidFormat)
+		return
+	}
+	if fields[4] == "" {
+		err = format.ErrMissingHash
+		return
+	}
+	checksum, ok = decode64(fields[4])
+	if !ok || len(checksum) != 32 {
+		err = fmt.Errorf("%w: invalid hash", format.ErrInvalidFormat)
+		return
+	}
+	return
+}
+
+// checkParams makes sure that the parameters are usable by yescrypt.
+func checkParams(p params) error {
+	switch {
+	case p.flags != Scrypt && p.flags != WORM && p.flags != RW:
+		return ErrInvalidFlags
+	case p.flags == Scrypt && p.t != 0:
+		return fmt.Errorf("%w: t must be 0 in the scrypt mode", format.ErrInvalidParam)
+	case p.n < 2 || p.n&(p.n-1) != 0:
+		return fmt.Errorf("%w: N must be a power of 2 greater than 1", format.ErrInvalidParam)
+	case p.r < 1 || p.p < 1:
+		return fmt.Errorf("%w: r and p must be at least 1", format.ErrInvalidParam)
+	case uint64(p.r)*uint64(p.p) >= 1<<30:
+		return fmt.Errorf("%w: r * p must be below 2^30", format.ErrInvalidParam)
+	case p.flags == RW && p.n/uint64(p.p) <= 3:
+		return fmt.Errorf("%w: N / p must be above 3 in the RW mode", format.ErrInvalidParam)
+	}
+	return nil
+}
+
+// encodeParams encodes the parameters the same way as libxcrypt: the flavor of the flags,
+// log2(N) and r, followed by p and t when they aren't the defaults.
+func encodeParams(p params) string {
+	flavor := uint32(p.flags)
+	if p.flags >= modeRW {
+		flavor = modeRW + uint32(p.flags)>>2
+	}
+
+	var sb strings.Builder
+	encode64Uint32(&sb, flavor, 0)
+	encode64Uint32(&sb, uint32(bits.TrailingZeros64(p.n)), 1)
+	encode64Uint32(&sb, p.r, 1)
+
+	var have uint32
+	if p.p != 1 {
+		have |= 1
+	}
+	if p.t != 0 {
+		have |= 2
+	}
+	if have != 0 {
+		encode64Uint32(&sb, have, 1)
+	}
+	if p.p != 1 {
+		encode64Uint32(&sb, p.p, 2)
+	}
+	if p.t != 0 {
+		encode64Uint32(&sb, p.t, 1)
+	}
+	return sb.String()
+}
+
+// decodeParams decodes the parameters encoded by encodeParams. The hash upgrades (g)
+// and the ROM (NROM) of yescrypt aren't supported, the same as libxcrypt.
+func decodeParams(s string) (p params, err error) {
+	invalid := fmt.Errorf("%w: invalid parameters %q", format.ErrInvalidFormat, s)
+
+	flavor, s, ok := decode64Uint32(s, 0)
+	if !ok {
+		return p, invalid
+	}
+	switch {
+	case flavor < modeRW:
+		p.flags = Flags(flavor)
+	case flavor <= modeRW+rwFlavorMask>>2:
+		p.flags = modeRW + Flags(flavor-modeRW)<<2
+	default:
+		return p, ErrInvalidFlags
+	}
+
+	nLog2, s, ok := decode64Uint32(s, 1)
+	if !ok || nLog2 > 63 {
+		return p, invalid
+	}
+	p.n = 1 << nLog2
+
+	p.r, s, ok = decode64Uint32(s, 1)
+	if !ok {
+		return p, invalid
+	}
+
+	p.p = 1
+	if s != "" {
+		var have uint32
+		have, s, ok = decode64Uint32(s, 1)
+		if !ok || have&^3 != 0 {
+			return p, fmt.Errorf("%w: unsupported parameters %q", format.ErrInvalidParam, s)
+		}
+		if have&1 != 0 {
+			if p.p, s, ok = decode64Uint32(s, 2); !ok {
+				return p, invalid
+			}
+		}
+		if have&2 != 0 {
+			if p.t, s, ok = decode64Uint32(s, 1); !ok {
+				return p, invalid
+			}
+		}
+	}
+	if s != "" {
+		return p, invalid
+	}
+	return p, nil
+}
+
+// encode64Uint32 writes a variable-length encoding of an integer of at least min,
+// where the first character tells the number of characters that follow.
+func encode64Uint32(sb *strings.Builder, src, min uint32) {
+	start, end, chars, nbits := uint32(0), uint32(47), 1, uint32(0)
+	src -= min
+	for {
+		count := (end + 1 - start) << nbits
+		if src < count {
+			break
+		}
+		start = end + 1
+		end = start + (62-end)/2
+		src -= count
+		chars++
+		nbits += 6
+	}
+
+	sb.WriteByte(cryptAlphabet[start+(src>>nbits)])
+	for ; chars > 1; chars-- {
+		nbits -= 6
+		sb.WriteByte(cryptAlphabet[(src>>nbits)&0x3f])
+	}
+}
+
+// decode64Uint32 reads an integer written by encode64Uint32, returning the rest of s.
+func decode64Uint32(s string, min uint32) (uint32, string, bool) {
+	if s == "" {
+		return 0, s, false
+	}
+	c := strings.IndexByte(cryptAlphabet, s[0])
+	if c < 0 {
+		return 0, s, false
+	}
+	s = s[1:]
+
+	start, end, chars, nbits := uint32(0), uint32(47), 1, uint32(0)
+	dst := uint64(min)
+	for uint32(c) > end {
+		dst += uint64(end+1-start) << nbits
+		start = end + 1
+		end = start + (62-end)/2
+		chars++
+		nbits += 6
+	}
+	dst += uint64(uint32(c)-start) << nbits
+
+	for ; chars > 1; chars-- {
+		if s == "" {
+			return 0, s, false
+		}
+		c = strings.IndexByte(cryptAlphabet, s[0])
+		if c < 0 {
+			return 0, s, false
+		}
+		s = s[1:]
+		nbits -= 6
+		dst += uint64(c) << nbits
+	}
+	if dst > 1<<32-1 {
+		return 0, s, false
+	}
+	return uint32(dst), s, true
+}
+
+// encode64 encodes bytes in the crypt(3) alphabet, three bytes at a time, least significant bits first.
+func encode64(src []byte) string {
+	var sb strings.Builder
+	for i := 0; i < len(src); {
+		var value, nbits uint32
+		for nbits < 24 && i < len(src) {
+			value |= uint32(src[i]) << nbits
+			nbits += 8
+			i++
+		}
+		for n := uint32(0); n < nbits; n += 6 {
+			sb.WriteByte(cryptAlphabet[value&0x3f])
+			value >>= 6
+		}
+	}
+	return sb.String()
+}
+
+// decode64 decodes a string encoded by encode64, rejecting the encodings that encode64 wouldn't create.
+func decode64(s string) ([]byte, bool) {
+	var dst []byte
+	for len(s) > 0 {
+		group := s[:min(4, len(s))]
+		s = s[len(group):]
+		if len(group) == 1 {
+			return nil, false
+		}
+
+		var value uint32
+		for i := 0; i < len(group); i++ {
+			c := strings.IndexByte(cryptAlphabet, group[i])
+			if c < 0 {
+				return nil, false
+			}
+			value |= uint32(c) << (6 * i)
+		}
+
+		nbytes := len(group) * 6 / 8
+		for i := 0; i < nbytes; i++ {
+			dst = append(dst, byte(value))
+			value >>= 8
+		}
+		if value != 0 {
+			return nil, false
+		}
+	}
+	return dst, true
+}
+
+// checkLimits makes sure that none of the parameters of a hash exceeds the limits.
+func checkLimits(limits Limits, p params) error {
+	limits = applyDefaultLimits(limits)
+	switch {
+	case p.n > uint64(limits.MaxCost):
+		return fmt.Errorf("%w: N=%d is above %d", format.ErrLimitExceeded, p.n, limits.MaxCost)
+	case uint64(p.r) > uint64(limits.MaxMemory)/128/p.n:
+		return fmt.Errorf("%w: memory of N=%d and r=%d is above %d bytes", format.ErrLimitExceeded, p.n, p.r, limits.MaxMemory)
+	case uint64(p.p) > uint64(limits.MaxParallelism):
+		return fmt.Errorf("%w: p=%d is above %d", format.ErrLimitExceeded, p.p, limits.MaxParallelism)
+	case uint64(p.t) > uint64(limits.MaxTime):
+		return fmt.Errorf("%w: t=%d is above %d", format.ErrLimitExceeded, p.t, limits.MaxTime)
+	}
+	return nil
+}
+
+// applyDefaultLimits fills the empty fields of limits with DefaultLimits.
+func applyDefaultLimits(limits Limits) Limits {
+	if limits.MaxCost <= 0 {
+		limits.MaxCost = DefaultLimits.MaxCost
+	}
+	if limits.MaxMemory <= 0 {
+		limits.MaxMemory = DefaultLimits.MaxMemory
+	}
+	if limits.MaxParallelism <= 0 {
+		limits.MaxParallelism = DefaultLimits.MaxParallelism
+	}
+	if limits.MaxTime <= 0 {
+		limits.MaxTime = DefaultLimits.MaxTime
+	}
+	return limits
+}
+
+// applyDefaults fills the empty fields of config with the package defaults.
+func applyDefaults(config Config) Config {
+	if config.Cost <= 0 {
+		config.Cost = COST
+	}
+	if config.Rounds <= 0 {
+		config.Rounds = ROUNDS
+	}
+	if config.Parallelism <= 0 {
+		config.Parallelism = PARALLELISM
+	}
+	if config.Time < 0 {
+		config.Time = 0
+	}
+	if config.Flags == Scrypt {
+		config.Flags = RW
+	}
+	if config.SaltLen <= 0 {
+		config.SaltLen = SALT_LENGTH
+	}
+	return config
+}
+
+// Hash creates a yescrypt hash with the config. See the package-level Hash function.
+func (c Config) Hash(plain string) (string, error) {
+	return Hash(plain, c)
+}
+
+// Verify checks the hash if it's equal (by an algorithm) to plain text provided,
+// rejecting hashes whose parameters exceed c.Limits. See the package-level Verify function.
+func (c Config) Verify(hash, plain string) (bool, error) {
+	if hash == "" || plain == "" {
+		return false, ErrEmptyField
+	}
+
+	p, salt, checksum, err := parseHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	if err := checkLimits(c.Limits, p); err != nil {
+		return false, err
+	}
+
+	verifyHash := key([]byte(plain), salt, p.flags, p.n, p.r, p.p, p.t)
+
+	if subtle.ConstantTimeCompare(checksum, verifyHash) == 1 {
+		return true, nil
+	}
+	return false, nil
+}
+
+// NeedsRehash checks whether the hash is weaker than the config. See the package-level NeedsRehash function.
+func (c Config) NeedsRehash(hash string) (bool, error) {
+	return NeedsRehash(hash, c)
+}
+
+// IDs returns the identifiers of the hashes that this package can verify.
+func (c Config) IDs() []string {
+	return []string{"y"}
+}
@@ -0,0 +1,250 @@
+package yescrypt_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aldy505/phc-crypto/format"
+	"github.com/aldy505/phc-crypto/yescrypt"
+)
+
+func TestHash(t *testing.T) {
+	t.Run("should be ok without additional config", func(t *testing.T) {
+		hash, err := yescrypt.Hash("password123", yescrypt.Config{})
+		if err != nil {
+			t.Error(err)
+		}
+		segments := strings.Split(hash, "$")
+		if len(segments) != 5 || segments[1] != "y" || segments[2] != "j9T" || len(segments[3]) != 22 || len(segments[4]) != 43 {
+			t.Error("unexpected encoding:", hash)
+		}
+	})
+
+	t.Run("should be ok with additional config", func(t *testing.T) {
+		hash, err := yescrypt.Hash("password123", yescrypt.Config{
+			Cost:        1024,
+			Rounds:      8,
+			Parallelism: 2,
+			Time:        1,
+			Flags:       yescrypt.WORM,
+			SaltLen:     8,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		if !strings.HasPrefix(hash, "$y$/750..$") {
+			t.Error("unexpected encoding:", hash)
+		}
+
+		verify, err := yescrypt.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should return error on invalid config", func(t *testing.T) {
+		testCases := []struct {
+			name   string
+			config yescrypt.Config
+			err    error
+		}{
+			{"flags", yescrypt.Config{Flags: 4}, yescrypt.ErrInvalidFlags},
+			{"cost", yescrypt.Config{Cost: 1000}, format.ErrInvalidParam},
+			{"parallelism", yescrypt.Config{Cost: 16, Parallelism: 8}, format.ErrInvalidParam},
+			{"salt length", yescrypt.Config{SaltLen: 65}, format.ErrInvalidParam},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := yescrypt.Hash("password123", tc.config)
+				if !errors.Is(err, tc.err) {
+					t.Errorf("expected %v, got: %v", tc.err, err)
+				}
+			})
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	testCases := []struct {
+		name string
+		hash string
+	}{
+		{"default", "$y$j9T$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r/L0zki0Fm7nl7yeDuySShwVAOWtG65Jkd2XA"},
+		{"rw", "$y$j75$k2XAnEHBqQ1Ct2aMXFKNa/$o4n6DxQO2TnJxXZ7vt8M1m2mhsPufv4SGsW0LPXEYQD"},
+		{"rw parallelism", "$y$j75..$k2XAnEHBqQ1Ct2aMXFKNa/$sKty.kRpuI6M017C7x2B5JT8JlVrXQWX6i1tFlmrV6C"},
+		{"rw time", "$y$j75//$k2XAnEHBqQ1Ct2aMXFKNa/$CzzgXhDXND1jfaYSL63ecf9CGeLrtCXrhVXcWLl.uf5"},
+		{"worm", "$y$/75$k2XAnEHBqQ1Ct2aMXFKNa/$UhvJI4b.HoHLCusZ8TKVp2kWVpku7W5RSGfGCi2mPx."},
+		{"worm parallelism and time", "$y$/750..$k2XAnEHBqQ1Ct2aMXFKNa/$IGhS5mCtiFZ3mi4q4WWT3bXkkZ0jOZOhb/SMQTyOkE2"},
+		{"scrypt", "$y$.75$k2XAnEHBqQ1Ct2aMXFKNa/$z5UQpPrBZ5irRQYk3zxzyksd5paAf71RrJcK0tAVdkC"},
+		{"empty salt", "$y$j9T$$CmKn0.AmVqexkKByCY3uzxl6uCX/HvYYPbw3I7W3/E4"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			verify, err := yescrypt.Verify(tc.hash, "password123")
+			if err != nil {
+				t.Error(err)
+			}
+			if !verify {
+				t.Error("verify function returned false")
+			}
+
+			verify, err = yescrypt.Verify(tc.hash, "password321")
+			if err != nil {
+				t.Error(err)
+			}
+			if verify {
+				t.Error("verify function returned true")
+			}
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	t.Run("should complain of empty function parameters", func(t *testing.T) {
+		if _, err := yescrypt.Hash("", yescrypt.Config{}); !errors.Is(err, yescrypt.ErrEmptyField) {
+			t.Error("expected ErrEmptyField, got:", err)
+		}
+		if _, err := yescrypt.Verify("", ""); !errors.Is(err, yescrypt.ErrEmptyField) {
+			t.Error("expected ErrEmptyField, got:", err)
+		}
+		if _, err := yescrypt.NeedsRehash("", yescrypt.Config{}); !errors.Is(err, yescrypt.ErrEmptyField) {
+			t.Error("expected ErrEmptyField, got:", err)
+		}
+	})
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	testCases := []struct {
+		name string
+		hash string
+		err  error
+	}{
+		{"not a yescrypt hash", "$7$j9T$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r", format.ErrInvalidFormat},
+		{"too many fields", "$y$j9T$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r$", format.ErrInvalidFormat},
+		{"missing hash", "$y$j9T$k2XAnEHBqQ1Ct2aMXFKNa/$", format.ErrMissingHash},
+		{"short hash", "$y$j9T$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r", format.ErrInvalidFormat},
+		{"invalid salt", "$y$j9T$k2XAnEHBqQ1Ct2aMXFKNaz$vRF0I4r/L0zki0Fm7nl7yeDuySShwVAOWtG65Jkd2XA", format.ErrInvalidFormat},
+		{"truncated params", "$y$j9$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r/L0zki0Fm7nl7yeDuySShwVAOWtG65Jkd2XA", format.ErrInvalidFormat},
+		{"unsupported flags", "$y$i9T$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r/L0zki0Fm7nl7yeDuySShwVAOWtG65Jkd2XA", yescrypt.ErrInvalidFlags},
+		{"unsupported rom", "$y$j9T3$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r/L0zki0Fm7nl7yeDuySShwVAOWtG65Jkd2XA", format.ErrInvalidParam},
+		{"time in scrypt mode", "$y$.75//$k2XAnEHBqQ1Ct2aMXFKNa/$z5UQpPrBZ5irRQYk3zxzyksd5paAf71RrJcK0tAVdkC", format.ErrInvalidParam},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := yescrypt.Verify(tc.hash, "password123")
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifyLimits(t *testing.T) {
+	t.Run("should reject hashes above the default limits", func(t *testing.T) {
+		_, err := yescrypt.Verify("$y$jPT$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r/L0zki0Fm7nl7yeDuySShwVAOWtG65Jkd2XA", "password123")
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("expected ErrLimitExceeded, got:", err)
+		}
+	})
+
+	t.Run("should enforce the limits of the config", func(t *testing.T) {
+		config := yescrypt.Config{Limits: yescrypt.Limits{MaxMemory: 1 << 20}}
+		_, err := config.Verify("$y$j9T$k2XAnEHBqQ1Ct2aMXFKNa/$vRF0I4r/L0zki0Fm7nl7yeDuySShwVAOWtG65Jkd2XA", "password123")
+		if !errors.Is(err, format.ErrLimitExceeded) {
+			t.Error("expected ErrLimitExceeded, got:", err)
+		}
+
+		verify, err := config.Verify("$y$j75$k2XAnEHBqQ1Ct2aMXFKNa/$o4n6DxQO2TnJxXZ7vt8M1m2mhsPufv4SGsW0LPXEYQD", "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hash := "$y$j75$k2XAnEHBqQ1Ct2aMXFKNa/$o4n6DxQO2TnJxXZ7vt8M1m2mhsPufv4SGsW0LPXEYQD"
+
+	t.Run("should return false on the same config", func(t *testing.T) {
+		rehash, err := yescrypt.NeedsRehash(hash, yescrypt.Config{Cost: 1024, Rounds: 8})
+		if err != nil {
+			t.Error(err)
+		}
+		if rehash {
+			t.Error("needs rehash function returned true")
+		}
+	})
+
+	t.Run("should return true on stronger config", func(t *testing.T) {
+		rehash, err := yescrypt.NeedsRehash(hash, yescrypt.Config{})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+
+	t.Run("should return true on other flags", func(t *testing.T) {
+		rehash, err := yescrypt.NeedsRehash(hash, yescrypt.Config{Cost: 1024, Rounds: 8, Flags: yescrypt.WORM})
+		if err != nil {
+			t.Error(err)
+		}
+		if !rehash {
+			t.Error("needs rehash function returned false")
+		}
+	})
+}
+
+func TestCalibrate(t *testing.T) {
+	t.Run("should stay within the budget and the limits", func(t *testing.T) {
+		config, err := yescrypt.Calibrate(20*time.Millisecond, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if 128*config.Cost*config.Rounds > 1<<20 || config.Time > yescrypt.DefaultLimits.MaxTime {
+			t.Errorf("unexpected config: %+v", config)
+		}
+
+		hash, err := yescrypt.Hash("password123", config)
+		if err != nil {
+			t.Error(err)
+		}
+		verify, err := yescrypt.Verify(hash, "password123")
+		if err != nil {
+			t.Error(err)
+		}
+		if !verify {
+			t.Error("verify function returned false")
+		}
+	})
+
+	t.Run("should lower the cost for a short target", func(t *testing.T) {
+		config, err := yescrypt.Calibrate(time.Nanosecond, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Cost != 4 || config.Time != 0 {
+			t.Errorf("unexpected config: %+v", config)
+		}
+	})
+
+	t.Run("should return error on invalid arguments", func(t *testing.T) {
+		if _, err := yescrypt.Calibrate(0, 1<<20); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("expected ErrInvalidParam, got:", err)
+		}
+		if _, err := yescrypt.Calibrate(time.Second, 1024); !errors.Is(err, format.ErrInvalidParam) {
+			t.Error("expected ErrInvalidParam, got:", err)
+		}
+	})
+}